@@ -8,50 +8,95 @@ import (
 	"os/signal"
 	"prom/app/config"
 	"prom/app/fbr"
+	"prom/core/domain/auth"
 	"prom/core/domain/repository"
-	"sync"
+	"prom/core/usecases"
 	"syscall"
 	"time"
 
 	"prom/core/domain/logger"
 
-	"github.com/gofiber/contrib/otelfiber"
 	"github.com/gofiber/fiber/v2"
-	"go.opentelemetry.io/contrib/propagators/aws/xray"
 )
 
 type ProviderCancelFunc = func(context.Context) error
 
 type OtelProviderImpl struct {
-	TracerProvider  func(context.Context) ProviderCancelFunc
-	MetricsProvider func(context.Context) ProviderCancelFunc
+	TracerProvider  func(context.Context, *config.AppConfig) (ProviderCancelFunc, error)
+	MetricsProvider func(context.Context, *config.AppConfig) (ProviderCancelFunc, error)
 }
 
 type Application struct {
+	Config          *config.AppConfig
 	Logger          logger.Logger
 	HttpAdapter     *fiber.App
 	UserRepo        repository.Connection
+	Policy          *auth.Policy
   OtelProvider    *OtelProviderImpl
 	// TODO cleaner shutdown func
 	tracerProviderShutdownFunc  ProviderCancelFunc
 	metricsProviderShutdownFunc ProviderCancelFunc
+	health                      fbr.Health
+	server                      *fbr.Server
+	adminServer                 *fbr.Server
 }
 
-var conf = config.GetConfig()
+func (a *Application) Start() error {
+	// Neither blocks on the collector, the telemetry is buffered until it is reachable
+	tracerShutdown, err := a.OtelProvider.TracerProvider(context.Background(), a.Config)
+	if err != nil {
+		return err
+	}
+	a.tracerProviderShutdownFunc = tracerShutdown
+
+	metricsShutdown, err := a.OtelProvider.MetricsProvider(context.Background(), a.Config)
+	if err != nil {
+		return err
+	}
+	a.metricsProviderShutdownFunc = metricsShutdown
+
+	if a.Config.AuthBootstrapApiKey != "" {
+		if err := usecases.SeedApiKey(a.UserRepo, context.Background(), "bootstrap", a.Config.AuthBootstrapApiKey); err != nil {
+			return fmt.Errorf("Cannot seed the bootstrap API key: %w", err)
+		}
+	}
+
+	if err := fbr.InitHttpAdapter(a.HttpAdapter, a.Config, a.UserRepo, a.Policy, a.Logger, &a.health); err != nil {
+		return err
+	}
+
+	server, err := fbr.Serve(a.HttpAdapter, a.Config)
+	if err != nil {
+		return err
+	}
+	a.server = server
+
+	admin := fiber.New(fiber.Config{DisableStartupMessage: true})
+	if fbr.InitAdminAdapter(admin, a.Config, a.Logger) {
+		adminServer, err := fbr.ServeAdmin(admin, a.Config)
+		if err != nil {
+			return err
+		}
+		a.adminServer = adminServer
+	}
 
-func (a *Application) Start() {
-	a.tracerProviderShutdownFunc = a.OtelProvider.TracerProvider(context.Background())
-	a.metricsProviderShutdownFunc = a.OtelProvider.MetricsProvider(context.Background())
-	a.HttpAdapter.Use(otelfiber.Middleware(conf.ServiceName,
-		otelfiber.WithPropagators(xray.Propagator{}),
-	))
-	fbr.InitHttpAdapter(a.HttpAdapter, a.UserRepo, a.Logger)
+	a.health.SetReady(true)
+
+	return nil
 }
 
+type shutdownOp struct {
+	name string
+	op   ProviderCancelFunc
+}
+
+// shutdownHelper waits for a termination signal or for the http adapters to stop
+// and then runs the ops one after the other in the given order
 func shutdownHelper(
-	ctx context.Context,
+	serveErr <-chan error,
+	adminErr <-chan error,
 	timeout time.Duration,
-	ops map[string]ProviderCancelFunc,
+	ops []shutdownOp,
 ) <-chan struct{} {
 	wait := make(chan struct{})
 	go func() {
@@ -60,9 +105,15 @@ func shutdownHelper(
 
 		// SIGHUP could be used to recreate application without restarting the whole process
 		signal.Notify(s, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
-		<-s
 
-		log.Println("Shutting down")
+		select {
+		case <-s:
+			log.Println("Shutting down")
+		case err := <-serveErr:
+			log.Printf("Http adapter stopped serving: %v, shutting down", err)
+		case err := <-adminErr:
+			log.Printf("Admin adapter stopped serving: %v, shutting down", err)
+		}
 
 		// set timeout for forcing shutdown incase of hanging
 		timeoutFunc := time.AfterFunc(timeout, func() {
@@ -72,41 +123,58 @@ func shutdownHelper(
 
 		defer timeoutFunc.Stop()
 
-		var wg sync.WaitGroup
-		wg.Add(len(ops))
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
 
-		for key, op := range ops {
-			go func(key string, op ProviderCancelFunc) {
-				defer wg.Done()
-				log.Printf("Cleaning up: %s", key)
-				if err := op(ctx); err != nil {
-					log.Println(fmt.Sprintf("%s: clean up failed: %v", key, err))
-					return
-				}
+		for _, op := range ops {
+			log.Printf("Cleaning up: %s", op.name)
+			if err := op.op(ctx); err != nil {
+				log.Println(fmt.Sprintf("%s: clean up failed: %v", op.name, err))
+				continue
+			}
 
-				log.Printf("%s was shutdown gracefully", key)
-			}(key, op)
+			log.Printf("%s was shutdown gracefully", op.name)
 		}
 
-		wg.Wait()
-
 		close(wait)
 	}()
 
 	return wait
 }
 
+// Shutdown stops receiving traffic first, drains the in-flight requests, closes the
+// db pool and flushes the telemetry last so the spans of the drained requests are exported
 func (a *Application) Shutdown() {
-	wait := shutdownHelper(context.Background(), 2*time.Second, map[string]ProviderCancelFunc{
-		"httpAdapter": func(ctx context.Context) error {
-			return a.HttpAdapter.Shutdown()
-		},
-		"metricsProvider": func(ctx context.Context) error {
+	wait := shutdownHelper(a.server.Err(), a.adminServer.Err(), a.Config.ShutdownTimeout, []shutdownOp{
+		{"readiness", func(ctx context.Context) error {
+			a.health.SetReady(false)
+			return nil
+		}},
+		{"httpAdapter", func(ctx context.Context) error {
+			return a.server.Shutdown(ctx)
+		}},
+		{"adminAdapter", func(ctx context.Context) error {
+			return a.adminServer.Shutdown(ctx)
+		}},
+		{"userRepo", func(ctx context.Context) error {
+			sqlDB, err := a.UserRepo.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.Close()
+		}},
+		{"metricsProvider", func(ctx context.Context) error {
 			return a.metricsProviderShutdownFunc(ctx)
-		},
-		"tracerProvider": func(ctx context.Context) error {
+		}},
+		{"tracerProvider", func(ctx context.Context) error {
 			return a.tracerProviderShutdownFunc(ctx)
-		},
+		}},
+		{"logger", func(ctx context.Context) error {
+			if s, ok := a.Logger.(interface{ Shutdown(context.Context) error }); ok {
+				return s.Shutdown(ctx)
+			}
+			return a.Logger.Sync()
+		}},
 	})
 	<-wait
 }
@@ -0,0 +1,294 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// minRefreshInterval limits the refreshes triggered by tokens signed with an
+// unknown key id, so forged key ids can't be used to flood the issuer
+const minRefreshInterval = time.Minute
+
+// keySet caches the keys of a JWKS document, they are reloaded once the ttl
+// expires or when a token is signed with an unknown key. The stale keys are
+// served while the document is reloaded and kept while it can't be
+type keySet struct {
+	load func(ctx context.Context) ([]byte, error)
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	keys    map[string]interface{}
+	fetched time.Time
+	// Error of the last refresh, returned while there are no keys
+	err error
+	// Closed once the refresh in flight is done, nil without one
+	refreshing chan struct{}
+}
+
+func newFileKeySet(path string, ttl time.Duration) *keySet {
+	return &keySet{
+		ttl: ttl,
+		load: func(ctx context.Context) ([]byte, error) {
+			return os.ReadFile(path)
+		},
+	}
+}
+
+// newURLKeySet fetches the keys from the url, when empty the url is discovered
+// from the openid configuration of the issuer
+func newURLKeySet(client *http.Client, url, issuer string, ttl time.Duration) *keySet {
+	return &keySet{
+		ttl: ttl,
+		load: func(ctx context.Context) ([]byte, error) {
+			if url == "" {
+				discovered, err := discoverJWKSURL(ctx, client, issuer)
+				if err != nil {
+					return nil, err
+				}
+				url = discovered
+			}
+			return get(ctx, client, url)
+		},
+	}
+}
+
+// key returns the public key, or the secret for an oct key, with the given id.
+// The id can be omitted when the set has a single key. Only the callers that
+// don't know the key wait for the refresh, never behind the lock
+func (s *keySet) key(ctx context.Context, kid string) (interface{}, error) {
+	s.mu.Lock()
+	k, known := s.lookup(kid)
+	since := time.Since(s.fetched)
+	var done <-chan struct{}
+	if s.keys == nil || since > s.ttl || (!known && since > minRefreshInterval) {
+		done = s.refresh()
+	} else if !known {
+		done = s.refreshing
+	}
+	s.mu.Unlock()
+
+	if known {
+		return k, nil
+	}
+	if done != nil {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		s.mu.Lock()
+		k, known = s.lookup(kid)
+		keys, err := s.keys, s.err
+		s.mu.Unlock()
+		if known {
+			return k, nil
+		}
+		if keys == nil && err != nil {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("Unknown signing key %q", kid)
+}
+
+// lookup must be called with s.mu held
+func (s *keySet) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, k := range s.keys {
+			return k, true
+		}
+	}
+	k, ok := s.keys[kid]
+	return k, ok
+}
+
+// refresh starts reloading the keys unless a refresh is in flight already and
+// returns its done channel, it must be called with s.mu held. The document is
+// loaded apart from the request so a canceled request doesn't fail the others
+// waiting for it
+func (s *keySet) refresh() <-chan struct{} {
+	if s.refreshing != nil {
+		return s.refreshing
+	}
+	done := make(chan struct{})
+	s.refreshing = done
+
+	go func() {
+		defer close(done)
+		keys, err := s.fetch(context.Background())
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// Failures are retried at most once per minRefreshInterval too
+		s.fetched = time.Now()
+		s.err = err
+		if err == nil {
+			s.keys = keys
+		}
+		s.refreshing = nil
+	}()
+	return done
+}
+
+// preload loads the keys synchronously, e.g. at startup
+func (s *keySet) preload(ctx context.Context) error {
+	keys, err := s.fetch(ctx)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys, s.fetched = keys, time.Now()
+	return nil
+}
+
+func (s *keySet) fetch(ctx context.Context) (map[string]interface{}, error) {
+	data, err := s.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot load the JWKS: %w", err)
+	}
+	return parseJWKS(data)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// parseJWKS decodes the RSA, EC and oct keys of a JWKS document by key id, the
+// encryption keys and the unsupported key types are ignored
+func parseJWKS(data []byte) (map[string]interface{}, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("Cannot decode the JWKS: %w", err)
+	}
+
+	keys := make(map[string]interface{}, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		var (
+			key interface{}
+			err error
+		)
+		switch k.Kty {
+		case "RSA":
+			key, err = rsaKey(k)
+		case "EC":
+			key, err = ecKey(k)
+		case "oct":
+			key, err = base64.RawURLEncoding.DecodeString(k.K)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Invalid key %q in the JWKS: %w", k.Kid, err)
+		}
+		keys[k.Kid] = key
+	}
+	return keys, nil
+}
+
+func rsaKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := decodeInt(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := decodeInt(k.E)
+	if err != nil {
+		return nil, err
+	}
+	if !e.IsInt64() || e.Int64() > 1<<31-1 {
+		return nil, fmt.Errorf("Invalid RSA exponent")
+	}
+	return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+}
+
+func ecKey(k jwk) (*ecdsa.PublicKey, error) {
+	var curve elliptic.Curve
+	switch k.Crv {
+	case "P-256":
+		curve = elliptic.P256()
+	case "P-384":
+		curve = elliptic.P384()
+	case "P-521":
+		curve = elliptic.P521()
+	default:
+		return nil, fmt.Errorf("Unsupported curve %q", k.Crv)
+	}
+	x, err := decodeInt(k.X)
+	if err != nil {
+		return nil, err
+	}
+	y, err := decodeInt(k.Y)
+	if err != nil {
+		return nil, err
+	}
+	if !curve.IsOnCurve(x, y) {
+		return nil, fmt.Errorf("The point is not on the curve %s", k.Crv)
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+func discoverJWKSURL(ctx context.Context, client *http.Client, issuer string) (string, error) {
+	data, err := get(ctx, client, strings.TrimSuffix(issuer, "/")+"/.well-known/openid-configuration")
+	if err != nil {
+		return "", err
+	}
+	var conf struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return "", fmt.Errorf("Cannot decode the openid configuration: %w", err)
+	}
+	if conf.JWKSURI == "" {
+		return "", fmt.Errorf("The openid configuration of %s has no jwks_uri", issuer)
+	}
+	return conf.JWKSURI, nil
+}
+
+func get(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s responded with status %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
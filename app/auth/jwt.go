@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"prom/app/config"
+	"prom/core/domain/auth"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// JWTVerifier validates the bearer tokens and turns their claims into a Principal
+type JWTVerifier struct {
+	keys        *keySet
+	secret      []byte
+	parser      *jwt.Parser
+	issuer      string
+	audience    string
+	skew        time.Duration
+	rolesClaim  string
+	tenantClaim string
+}
+
+// NewJWTVerifier loads the keys from the JWKS file, from the JWKS url or from the
+// url advertised by the issuer, a local file is read right away so a broken
+// file fails the startup. HS256 tokens are verified with the shared secret
+func NewJWTVerifier(conf *config.AppConfig) (*JWTVerifier, error) {
+	v := &JWTVerifier{
+		secret:      []byte(conf.AuthHMACSecret),
+		parser:      jwt.NewParser(jwt.WithValidMethods(conf.AuthAlgorithms), jwt.WithoutClaimsValidation()),
+		issuer:      conf.AuthIssuer,
+		audience:    conf.AuthAudience,
+		skew:        conf.AuthClockSkew,
+		rolesClaim:  conf.AuthRolesClaim,
+		tenantClaim: conf.AuthTenantClaim,
+	}
+
+	switch {
+	case conf.AuthJWKSFile != "":
+		v.keys = newFileKeySet(conf.AuthJWKSFile, conf.AuthJWKSCacheTTL)
+		if err := v.keys.preload(context.Background()); err != nil {
+			return nil, err
+		}
+	case conf.AuthJWKSURL != "" || conf.AuthIssuer != "":
+		client := &http.Client{Timeout: 10 * time.Second}
+		v.keys = newURLKeySet(client, conf.AuthJWKSURL, conf.AuthIssuer, conf.AuthJWKSCacheTTL)
+	case len(v.secret) == 0:
+		return nil, fmt.Errorf("JWT authentication needs AUTH_JWKS_FILE, AUTH_JWKS_URL, AUTH_ISSUER or AUTH_HMAC_SECRET")
+	}
+
+	return v, nil
+}
+
+// Verify checks the signature, the expiration, the issuer and the audience of
+// the token, the subject is required
+func (v *JWTVerifier) Verify(ctx context.Context, raw string) (*auth.Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(raw, claims, func(t *jwt.Token) (interface{}, error) {
+		return v.key(ctx, t)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Invalid token: %w", err)
+	}
+
+	now := time.Now()
+	if !claims.VerifyExpiresAt(now.Add(-v.skew).Unix(), true) {
+		return nil, fmt.Errorf("The token is expired or has no exp claim")
+	}
+	if !claims.VerifyNotBefore(now.Add(v.skew).Unix(), false) {
+		return nil, fmt.Errorf("The token is not valid yet")
+	}
+	if v.issuer != "" && !claims.VerifyIssuer(v.issuer, true) {
+		return nil, fmt.Errorf("Unexpected token issuer %v", claims["iss"])
+	}
+	if v.audience != "" && !claims.VerifyAudience(v.audience, true) {
+		return nil, fmt.Errorf("The token audience does not include %s", v.audience)
+	}
+
+	subject, _ := claims["sub"].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("The token has no sub claim")
+	}
+	issuer, _ := claims["iss"].(string)
+	tenant, _ := claims[v.tenantClaim].(string)
+
+	scopes := stringsClaim(claims["scope"])
+	if len(scopes) == 0 {
+		scopes = stringsClaim(claims["scp"])
+	}
+
+	return &auth.Principal{
+		Subject: subject,
+		Issuer:  issuer,
+		Method:  "jwt",
+		Roles:   stringsClaim(claims[v.rolesClaim]),
+		Scopes:  scopes,
+		Tenant:  tenant,
+	}, nil
+}
+
+// key selects the key by the kid header, the shared secret is used for the
+// HMAC tokens unless the JWKS has an oct key with that id
+func (v *JWTVerifier) key(ctx context.Context, t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	_, hmac := t.Method.(*jwt.SigningMethodHMAC)
+
+	if v.keys != nil && (!hmac || kid != "") {
+		key, err := v.keys.key(ctx, kid)
+		if err == nil || !hmac {
+			return key, err
+		}
+	}
+	if hmac && len(v.secret) > 0 {
+		return v.secret, nil
+	}
+	return nil, fmt.Errorf("No key to verify a %s token", t.Method.Alg())
+}
+
+// stringsClaim accepts both a list and a space separated string, as in the
+// OAuth scope claim
+func stringsClaim(v interface{}) []string {
+	switch val := v.(type) {
+	case string:
+		return strings.Fields(val)
+	case []interface{}:
+		values := make([]string, 0, len(val))
+		for _, item := range val {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"prom/app/config"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func b64(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func jwksDocument(rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) []byte {
+	doc, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N), "e": b64(big.NewInt(int64(rsaKey.E)))},
+		{"kty": "EC", "kid": "ec-1", "crv": "P-256", "x": b64(ecKey.X), "y": b64(ecKey.Y)},
+	}})
+	return doc
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	raw, err := token.SignedString(key)
+	assert.NoError(t, err)
+	return raw
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub":       "alice",
+		"iss":       "https://issuer.example.com",
+		"aud":       "ms-baselines-golang",
+		"exp":       time.Now().Add(time.Hour).Unix(),
+		"roles":     []string{"admin"},
+		"scope":     "user:read user:write",
+		"tenant_id": "acme",
+	}
+}
+
+func testConfig() *config.AppConfig {
+	return &config.AppConfig{
+		AuthIssuer:       "https://issuer.example.com",
+		AuthAudience:     "ms-baselines-golang",
+		AuthAlgorithms:   []string{"RS256", "ES256", "HS256"},
+		AuthJWKSCacheTTL: time.Minute,
+		AuthClockSkew:    30 * time.Second,
+		AuthRolesClaim:   "roles",
+		AuthTenantClaim:  "tenant_id",
+	}
+}
+
+func TestJWTVerifierJWKSFile(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	conf := testConfig()
+	conf.AuthJWKSFile = filepath.Join(t.TempDir(), "jwks.json")
+	assert.NoError(t, os.WriteFile(conf.AuthJWKSFile, jwksDocument(rsaKey, ecKey), 0o600))
+
+	v, err := NewJWTVerifier(conf)
+	assert.NoError(t, err)
+	ctx := context.Background()
+
+	p, err := v.Verify(ctx, sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, validClaims()))
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", p.Subject)
+	assert.Equal(t, "jwt", p.Method)
+	assert.Equal(t, []string{"admin"}, p.Roles)
+	assert.Equal(t, []string{"user:read", "user:write"}, p.Scopes)
+	assert.Equal(t, "acme", p.Tenant)
+
+	_, err = v.Verify(ctx, sign(t, jwt.SigningMethodES256, "ec-1", ecKey, validClaims()))
+	assert.NoError(t, err)
+
+	expired := validClaims()
+	expired["exp"] = time.Now().Add(-time.Minute).Unix()
+	_, err = v.Verify(ctx, sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, expired))
+	assert.Error(t, err)
+
+	// Within the clock skew
+	skewed := validClaims()
+	skewed["exp"] = time.Now().Add(-10 * time.Second).Unix()
+	_, err = v.Verify(ctx, sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, skewed))
+	assert.NoError(t, err)
+
+	wrongAud := validClaims()
+	wrongAud["aud"] = "another-service"
+	_, err = v.Verify(ctx, sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, wrongAud))
+	assert.Error(t, err)
+
+	wrongIss := validClaims()
+	wrongIss["iss"] = "https://evil.example.com"
+	_, err = v.Verify(ctx, sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, wrongIss))
+	assert.Error(t, err)
+
+	// Signed by a key that is not in the JWKS
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, err = v.Verify(ctx, sign(t, jwt.SigningMethodRS256, "rsa-1", otherKey, validClaims()))
+	assert.Error(t, err)
+
+	_, err = v.Verify(ctx, sign(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, validClaims()))
+	assert.Error(t, err)
+}
+
+func TestJWTVerifierHMAC(t *testing.T) {
+	conf := testConfig()
+	conf.AuthHMACSecret = "secret"
+	v, err := NewJWTVerifier(conf)
+	assert.NoError(t, err)
+
+	_, err = v.Verify(context.Background(), sign(t, jwt.SigningMethodHS256, "", []byte("secret"), validClaims()))
+	assert.NoError(t, err)
+	_, err = v.Verify(context.Background(), sign(t, jwt.SigningMethodHS256, "", []byte("guessed"), validClaims()))
+	assert.Error(t, err)
+}
+
+func TestJWTVerifierIssuerDiscovery(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	var fetches atomic.Int32
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"jwks_uri": srv.URL + "/keys"})
+		case "/keys":
+			fetches.Add(1)
+			w.Write(jwksDocument(rsaKey, ecKey))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	conf := testConfig()
+	conf.AuthIssuer = srv.URL
+	v, err := NewJWTVerifier(conf)
+	assert.NoError(t, err)
+
+	claims := validClaims()
+	claims["iss"] = srv.URL
+	for i := 0; i < 3; i++ {
+		_, err = v.Verify(context.Background(), sign(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims))
+		assert.NoError(t, err)
+	}
+	// An unknown key id does not refresh the keys again right away
+	_, err = v.Verify(context.Background(), sign(t, jwt.SigningMethodRS256, "rsa-2", rsaKey, claims))
+	assert.Error(t, err)
+	assert.Equal(t, int32(1), fetches.Load())
+}
+
+func TestNewJWTVerifierWithoutKeys(t *testing.T) {
+	_, err := NewJWTVerifier(&config.AppConfig{})
+	assert.Error(t, err)
+}
+
+func TestKeySetRefresh(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	release := make(chan struct{})
+	var loads atomic.Int32
+	s := &keySet{ttl: time.Minute, load: func(ctx context.Context) ([]byte, error) {
+		// The refreshes after the first load hang until released
+		if loads.Add(1) > 1 {
+			<-release
+		}
+		return jwksDocument(rsaKey, ecKey), nil
+	}}
+	ctx := context.Background()
+	_, err := s.key(ctx, "rsa-1")
+	assert.NoError(t, err)
+
+	// The stale keys are served while the expired set is refreshed
+	s.mu.Lock()
+	s.fetched = time.Now().Add(-2 * time.Minute)
+	s.mu.Unlock()
+	for i := 0; i < 3; i++ {
+		_, err = s.key(ctx, "ec-1")
+		assert.NoError(t, err)
+	}
+
+	// An unknown key waits for the refresh in flight, at most until canceled
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = s.key(canceled, "rsa-2")
+	assert.ErrorIs(t, err, context.Canceled)
+
+	close(release)
+	_, err = s.key(ctx, "rsa-2")
+	assert.Error(t, err)
+	assert.Equal(t, int32(2), loads.Load())
+}
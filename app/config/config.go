@@ -1,30 +1,209 @@
 package config
 
 import (
-	"log"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
-var (
-	c *appConfig
-)
-
-type appConfig struct {
+type AppConfig struct {
   Port               string `env:"PORT" env-default:"3000"`
 	ServiceName        string `env:"SERVICE_NAME"         env-required:"true"`
+	ServiceVersion     string `env:"SERVICE_VERSION"                          env-default:"dev"`
+	Environment        string `env:"ENVIRONMENT"                              env-default:"local"`
 	OTELCollectorURL   string `env:"OTEL_COLLECTOR_URL"                       env-default:"localhost:4317"`
 	DBConnectionString string `env:"DB_CONNECTION_STRING" env-required:"true"`
+	// Deprecated, false is kept as an alias of TRACES_EXPORTER=stdout
 	EnableOtelTraces   bool   `env:"ENABLE_OTEL_TRACES"                       env-default:"true"`
+	// silent, error, warn or info, info logs every statement
+	DBLogLevel         string        `env:"DB_LOG_LEVEL"                      env-default:"warn"`
+	DBSlowThreshold    time.Duration `env:"DB_SLOW_THRESHOLD"                 env-default:"1s"`
+	// The statements are logged with the values replaced by ? unless enabled
+	DBLogParameters    bool          `env:"DB_LOG_PARAMETERS"                 env-default:"false"`
+	// otlp, otlphttp, file, stdout or none
+	TracesExporter             string        `env:"TRACES_EXPORTER"               env-default:"otlp"`
+	// Spans buffered in memory while the collector is unavailable, dropped past it
+	TracesExportQueueSize      int           `env:"TRACES_EXPORT_QUEUE_SIZE"      env-default:"2048"`
+	TracesExportBatchSize      int           `env:"TRACES_EXPORT_BATCH_SIZE"      env-default:"512"`
+	// always_on, always_off, parentbased_traceidratio or xray
+	TracesSampler              string        `env:"TRACES_SAMPLER"                env-default:"always_on"`
+	TracesSamplerRatio         float64       `env:"TRACES_SAMPLER_RATIO"          env-default:"1"`
+	// Ratio used by the xray sampler while the sampling rules can't be fetched
+	TracesSamplerFallbackRatio float64       `env:"TRACES_SAMPLER_FALLBACK_RATIO" env-default:"0.05"`
+	XRaySamplingURL            string        `env:"XRAY_SAMPLING_URL"             env-default:"http://localhost:2000"`
+	XRaySamplingInterval       time.Duration `env:"XRAY_SAMPLING_INTERVAL"        env-default:"5m"`
+	// Any of tracecontext, baggage, b3, b3multi, xray or none
+	Propagators                []string      `env:"OTEL_PROPAGATORS"              env-default:"xray" env-separator:","`
+	// Any of otlp, otlphttp, prometheus, file, stdout and none, prometheus is
+	// scraped from /metrics in the admin port
+	MetricsExporters           []string      `env:"METRICS_EXPORTERS"             env-default:"otlp" env-separator:","`
+	// Bucket boundaries in milliseconds of the latency histograms
+	MetricsHistogramBuckets    []float64     `env:"METRICS_HISTOGRAM_BUCKETS"     env-default:"5,10,25,50,75,100,250,500,750,1000,2500,5000,7500,10000" env-separator:","`
+	LogLevel           string        `env:"LOG_LEVEL"                         env-default:"info"`
+	// json or console
+	LogEncoding        string        `env:"LOG_ENCODING"                      env-default:"json"`
+	LogCaller          bool          `env:"LOG_CALLER"                        env-default:"true"`
+	// Lowest level logged with a stacktrace, none disables them
+	LogStacktraceLevel string        `env:"LOG_STACKTRACE_LEVEL"              env-default:"error"`
+	// Fields always redacted, matched by name ignoring the case
+	LogRedactFields    []string      `env:"LOG_REDACT_FIELDS"                 env-default:"user-name,name,email,password,authorization" env-separator:","`
+	// Regular expressions scrubbed from the messages and string values
+	LogRedactPatterns  []string      `env:"LOG_REDACT_PATTERNS"               env-default:"[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\\.[A-Za-z]{2,}" env-separator:";"`
+	// mask or hash, hash keeps the values correlatable with an HMAC-SHA256
+	LogRedactMode      string        `env:"LOG_REDACT_MODE"                   env-default:"mask"`
+	// Required by the hash mode
+	LogRedactHashKey   string        `env:"LOG_REDACT_HASH_KEY"`
+	// Any of stdout, otlp, otlphttp, file, span_events and none
+	LogExporters       []string      `env:"LOG_EXPORTERS"                     env-default:"stdout" env-separator:","`
+	LogExportQueueSize int           `env:"LOG_EXPORT_QUEUE_SIZE"             env-default:"2048"`
+	LogExportBatchSize int           `env:"LOG_EXPORT_BATCH_SIZE"             env-default:"512"`
+	LogExportInterval  time.Duration `env:"LOG_EXPORT_INTERVAL"               env-default:"1s"`
+	// OTLP over http, used by the signals exported with otlphttp
+	OTLPHTTPEndpoint    string            `env:"OTLP_HTTP_ENDPOINT"         env-default:"localhost:4318"`
+	// key1:value1,key2:value2 sent with every export, e.g. for authentication
+	OTLPHTTPHeaders     map[string]string `env:"OTLP_HTTP_HEADERS"`
+	// gzip or none
+	OTLPHTTPCompression string            `env:"OTLP_HTTP_COMPRESSION"      env-default:"gzip"`
+	OTLPHTTPInsecure    bool              `env:"OTLP_HTTP_INSECURE"         env-default:"false"`
+	// Verifies the collector with this CA instead of the system ones
+	OTLPHTTPCAFile      string            `env:"OTLP_HTTP_CA_FILE"`
+	// Client certificate for collectors requiring mutual TLS
+	OTLPHTTPCertFile    string            `env:"OTLP_HTTP_CERT_FILE"`
+	OTLPHTTPKeyFile     string            `env:"OTLP_HTTP_KEY_FILE"`
+	// JSON lines files of the file exporters, one per signal rotated by size
+	FileExporterDir        string         `env:"FILE_EXPORTER_DIR"          env-default:"telemetry"`
+	FileExporterMaxSizeMB  int            `env:"FILE_EXPORTER_MAX_SIZE_MB"  env-default:"100"`
+	FileExporterMaxBackups int            `env:"FILE_EXPORTER_MAX_BACKUPS"  env-default:"5"`
+	AccessLogEnabled       bool          `env:"ACCESS_LOG_ENABLED"          env-default:"true"`
+	// Ratio of the successful requests logged, errors and slow requests are always logged
+	AccessLogSampleRatio   float64       `env:"ACCESS_LOG_SAMPLE_RATIO"     env-default:"1"`
+	AccessLogSlowThreshold time.Duration `env:"ACCESS_LOG_SLOW_THRESHOLD"   env-default:"1s"`
+	// Bearer authentication of the routes, the JWTs are verified with the keys
+	// of the JWKS file, of the JWKS url or of the url advertised by the issuer
+	AuthEnabled            bool          `env:"AUTH_ENABLED"                env-default:"false"`
+	// Routes served without authentication, a trailing * matches any suffix
+	AuthSkipPaths          []string      `env:"AUTH_SKIP_PATHS"             env-default:"/health/*,/swagger/*,/version" env-separator:","`
+	AuthJWKSFile           string        `env:"AUTH_JWKS_FILE"`
+	AuthJWKSURL            string        `env:"AUTH_JWKS_URL"`
+	AuthJWKSCacheTTL       time.Duration `env:"AUTH_JWKS_CACHE_TTL"         env-default:"10m"`
+	// Expected iss claim, not checked when empty
+	AuthIssuer             string        `env:"AUTH_ISSUER"`
+	// Expected aud claim, not checked when empty
+	AuthAudience           string        `env:"AUTH_AUDIENCE"`
+	// Shared secret of the HS256 tokens
+	AuthHMACSecret         string        `env:"AUTH_HMAC_SECRET"`
+	AuthAlgorithms         []string      `env:"AUTH_ALGORITHMS"             env-default:"RS256,ES256,HS256" env-separator:","`
+	AuthClockSkew          time.Duration `env:"AUTH_CLOCK_SKEW"             env-default:"30s"`
+	AuthRolesClaim         string        `env:"AUTH_ROLES_CLAIM"            env-default:"roles"`
+	// Admin API key stored at startup when missing, pk_<prefix>_<secret>, so the
+	// first keys can be created. Revoking it through the api disables it for good
+	AuthBootstrapApiKey    string        `env:"AUTH_BOOTSTRAP_API_KEY"`
+	// role=action,action separated by ;, the admin action grants every action.
+	// Only enforced with AUTH_ENABLED, except the admin action always is
+	AuthzRoles             []string      `env:"AUTHZ_ROLES"                 env-default:"admin=admin;editor=user:read,user:write;viewer=user:read" env-separator:";"`
+	// Actions granted on their own user, owned when the subject of a JWT from
+	// AUTH_ISSUER is the user id, the API keys never own a user
+	AuthzOwnerActions      []string      `env:"AUTHZ_OWNER_ACTIONS"         env-default:"user:read,user:write" env-separator:","`
+	// Scopes the users by tenant, their queries fail without a tenant
+	TenancyEnabled         bool          `env:"TENANCY_ENABLED"             env-default:"false"`
+	// Any of claim, header and subdomain, the tenants found must agree. The
+	// tenant of an authenticated caller is always its claim and never the
+	// header, only trust the header when the anonymous callers can't pick it
+	TenancySources         []string      `env:"TENANCY_SOURCES"             env-default:"claim" env-separator:","`
+	TenancyHeader          string        `env:"TENANCY_HEADER"              env-default:"X-Tenant-ID"`
+	// The tenant is the label before the domain, e.g. acme in acme.api.example.com
+	// with api.example.com, the subdomain source is ignored when empty
+	TenancyDomain          string        `env:"TENANCY_DOMAIN"`
+	// JWT claim holding the tenant of the principal
+	AuthTenantClaim        string        `env:"AUTH_TENANT_CLAIM"           env-default:"tenant_id"`
+	RateLimitEnabled       bool          `env:"RATE_LIMIT_ENABLED"          env-default:"false"`
+	// token_bucket or sliding_window
+	RateLimitAlgorithm     string        `env:"RATE_LIMIT_ALGORITHM"        env-default:"token_bucket"`
+	// memory or mysql, mysql shares the limits between the replicas
+	RateLimitStore         string        `env:"RATE_LIMIT_STORE"            env-default:"memory"`
+	// Limit as requests/window of the routes without their own, none when empty
+	RateLimitDefault       string        `env:"RATE_LIMIT_DEFAULT"`
+	// METHOD path=requests/window separated by ;, a trailing * matches any suffix
+	RateLimitRoutes        []string      `env:"RATE_LIMIT_ROUTES"           env-default:"POST /v1/user=10/1m" env-separator:";"`
+	// The clients are keyed by the first of apikey, principal and ip they have
+	RateLimitKeyBy         []string      `env:"RATE_LIMIT_KEY_BY"           env-default:"apikey,principal,ip" env-separator:","`
+	RateLimitSkipPaths     []string      `env:"RATE_LIMIT_SKIP_PATHS"       env-default:"/health/*" env-separator:","`
+	// Limit as requests/window of the rejected credentials per ip, checked before
+	// the authentication so guessing keys is throttled too, none when empty
+	RateLimitAuthFailures  string        `env:"RATE_LIMIT_AUTH_FAILURES"    env-default:"10/1m"`
+	// Replays the responses of the user creations sent with an Idempotency-Key
+	IdempotencyEnabled     bool          `env:"IDEMPOTENCY_ENABLED"         env-default:"false"`
+	IdempotencyTTL         time.Duration `env:"IDEMPOTENCY_TTL"             env-default:"24h"`
+	// A key in flight for longer is considered abandoned and can be reused
+	IdempotencyLockTimeout time.Duration `env:"IDEMPOTENCY_LOCK_TIMEOUT"    env-default:"1m"`
+	// How long a duplicate waits for the request in flight before a 409
+	IdempotencyWaitTimeout time.Duration `env:"IDEMPOTENCY_WAIT_TIMEOUT"    env-default:"5s"`
+	AdminPort          string        `env:"ADMIN_PORT"                        env-default:"9464"`
+	// The admin port is not authenticated, the log level can only be read
+	// there unless enabled
+	AdminLogLevelWritable bool       `env:"ADMIN_LOG_LEVEL_WRITABLE"          env-default:"false"`
+	ShutdownTimeout    time.Duration `env:"SHUTDOWN_TIMEOUT"                  env-default:"10s"`
+	TLSCertFile        string        `env:"TLS_CERT_FILE"`
+	TLSKeyFile         string        `env:"TLS_KEY_FILE"`
+	// Enables mutual TLS, client certificates must be signed by one of these CAs
+	TLSClientCAFile    string        `env:"TLS_CLIENT_CA_FILE"`
+	// require or optional, only used when TLS_CLIENT_CA_FILE is set
+	TLSClientAuth      string        `env:"TLS_CLIENT_AUTH"                   env-default:"require"`
+	TLSReloadInterval  time.Duration `env:"TLS_RELOAD_INTERVAL"               env-default:"30s"`
+	// Plain http port redirecting to the TLS port, disabled when empty
+	HTTPRedirectPort   string        `env:"HTTP_REDIRECT_PORT"`
+	// Header holding the client ip set by the load balancer, e.g. X-Forwarded-For,
+	// the rate limits and the logs use the remote address when empty
+	ClientIPHeader     string        `env:"CLIENT_IP_HEADER"`
+	// IPs or CIDRs of the proxies allowed to set CLIENT_IP_HEADER and the
+	// X-Forwarded-Host and X-Forwarded-Proto headers, any other sender is ignored
+	TrustedProxies     []string      `env:"TRUSTED_PROXIES"                   env-separator:","`
+}
+
+// New reads the config from the environment, it is provided to the rest of the
+// application through the wire graph instead of being read by each package
+func New() (*AppConfig, error) {
+	c := new(AppConfig)
+	if err := cleanenv.ReadEnv(c); err != nil {
+		return nil, fmt.Errorf("Cannot read config: %w", err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, fmt.Errorf("Invalid config: %w", err)
+	}
+	return c, nil
+}
+
+// validate rejects the combinations of settings that can't be expressed with env tags
+func (c *AppConfig) validate() error {
+	if c.LogRedactMode == "hash" && c.LogRedactHashKey == "" {
+		return fmt.Errorf("LOG_REDACT_HASH_KEY is required when LOG_REDACT_MODE is hash")
+	}
+	return nil
+}
+
+// TracesExporterName resolves the deprecated ENABLE_OTEL_TRACES
+func (c *AppConfig) TracesExporterName() string {
+	if !c.EnableOtelTraces && c.TracesExporter == "otlp" {
+		return "stdout"
+	}
+	return c.TracesExporter
+}
+
+func (c *AppConfig) MetricsExporterEnabled(name string) bool {
+	return contains(c.MetricsExporters, name)
+}
+
+func (c *AppConfig) LogExporterEnabled(name string) bool {
+	return contains(c.LogExporters, name)
 }
 
-func GetConfig() *appConfig {
-	if c == nil {
-		c = new(appConfig)
-		err := cleanenv.ReadEnv(c)
-		if err != nil {
-			log.Fatal(err)
+func contains(list []string, name string) bool {
+	for _, e := range list {
+		if strings.TrimSpace(e) == name {
+			return true
 		}
 	}
-	return c
+	return false
 }
@@ -1,11 +1,9 @@
 package config
 
 import (
-	"log"
 	"os"
 	"testing"
 
-	"bou.ke/monkey"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -22,29 +20,63 @@ func setRequiredEnvs() {
 }
 
 func testRequired(t *testing.T) {
-	fakeLogFatal := func(msg ...interface{}) {
-		panic("log.Fatal called")
-	}
-	patch := monkey.Patch(log.Fatal, fakeLogFatal)
-	defer patch.Unpatch()
 	setRequiredEnvs()
-	GetConfig()
+	c, err := New()
+	assert.NoError(t, err)
+	assert.Equal(t, "ms-baselines-golang", c.ServiceName)
+	assert.Equal(t, "3000", c.Port)
+	assert.Equal(t, []string{"xray"}, c.Propagators)
+	assert.Len(t, c.MetricsHistogramBuckets, 14)
+	assert.Equal(t, []string{`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`}, c.LogRedactPatterns)
 }
 
 func testRequiredFail(t *testing.T) {
-	c = nil
-	fakeLogFatal := func(msg ...interface{}) {
-		panic("log.Fatal called")
-	}
-	patch := monkey.Patch(log.Fatal, fakeLogFatal)
-	defer patch.Unpatch()
-	assert.Panics(t, func() { GetConfig() }, "Not panic")
+	c, err := New()
+	assert.Error(t, err)
+	assert.Nil(t, c)
+}
+
+func testIndependentConfigs(t *testing.T) {
+	setRequiredEnvs()
+	os.Setenv("PORT", "8080")
+	first, err := New()
+	assert.NoError(t, err)
+
+	os.Setenv("PORT", "9090")
+	second, err := New()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "8080", first.Port)
+	assert.Equal(t, "9090", second.Port)
+}
+
+func testOTLPHTTPHeaders(t *testing.T) {
+	setRequiredEnvs()
+	os.Setenv("OTLP_HTTP_HEADERS", "api-key:secret,tenant:prom")
+	c, err := New()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"api-key": "secret", "tenant": "prom"}, c.OTLPHTTPHeaders)
+}
+
+func testRedactHashKeyRequired(t *testing.T) {
+	setRequiredEnvs()
+	os.Setenv("LOG_REDACT_MODE", "hash")
+	c, err := New()
+	assert.ErrorContains(t, err, "LOG_REDACT_HASH_KEY")
+	assert.Nil(t, c)
+
+	os.Setenv("LOG_REDACT_HASH_KEY", "secret")
+	_, err = New()
+	assert.NoError(t, err)
 }
 
 func TestController(t *testing.T) {
 	fs := map[string]func(*testing.T){
-		"testRequired":     testRequired,
-		"testRequiredFail": testRequiredFail,
+		"testRequired":              testRequired,
+		"testRequiredFail":          testRequiredFail,
+		"testIndependentConfigs":    testIndependentConfigs,
+		"testOTLPHTTPHeaders":       testOTLPHTTPHeaders,
+		"testRedactHashKeyRequired": testRedactHashKeyRequired,
 	}
 	for name, f := range fs {
 		cleanEnv()
@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"prom/app/config"
+	"prom/core/domain/logger"
+	"regexp"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"gorm.io/gorm/utils"
+)
+
+// sqlLiterals matches the quoted strings and the numbers inlined by gorm in
+// the logged statements
+var sqlLiterals = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.|"")*"|\b\d+(?:\.\d+)?\b`)
+
+// gormLogger sends the gorm logs to the logger.Logger so they carry the
+// trace of the request, the parameters are replaced by ? unless enabled
+type gormLogger struct {
+	log           logger.Logger
+	level         gormlogger.LogLevel
+	slowThreshold time.Duration
+	logParameters bool
+}
+
+func NewLogger(log logger.Logger, conf *config.AppConfig) (gormlogger.Interface, error) {
+	level, err := parseLogLevel(conf.DBLogLevel)
+	if err != nil {
+		return nil, err
+	}
+	return &gormLogger{
+		log:           log,
+		level:         level,
+		slowThreshold: conf.DBSlowThreshold,
+		logParameters: conf.DBLogParameters,
+	}, nil
+}
+
+func parseLogLevel(level string) (gormlogger.LogLevel, error) {
+	switch level {
+	case "silent":
+		return gormlogger.Silent, nil
+	case "error":
+		return gormlogger.Error, nil
+	case "warn":
+		return gormlogger.Warn, nil
+	case "info":
+		return gormlogger.Info, nil
+	default:
+		return 0, fmt.Errorf("Unknown db log level %q, expected silent, error, warn or info", level)
+	}
+}
+
+func (l *gormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	copy := *l
+	copy.level = level
+	return &copy
+}
+
+func (l *gormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Info {
+		l.log.Info(ctx, fmt.Sprintf(msg, data...), zap.String("db.caller", utils.FileWithLineNum()))
+	}
+}
+
+func (l *gormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		l.log.Warn(ctx, fmt.Sprintf(msg, data...), zap.String("db.caller", utils.FileWithLineNum()))
+	}
+}
+
+func (l *gormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Error {
+		l.log.Error(ctx, fmt.Sprintf(msg, data...), zap.String("db.caller", utils.FileWithLineNum()))
+	}
+}
+
+func (l *gormLogger) Trace(ctx context.Context, begin time.Time, fc func() (sql string, rowsAffected int64), err error) {
+	if l.level <= gormlogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	failed := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+	slow := l.slowThreshold > 0 && elapsed > l.slowThreshold
+
+	switch {
+	case failed && l.level >= gormlogger.Error:
+		l.log.Error(ctx, "Database query failed", append(l.queryFields(fc, elapsed), zap.Error(err))...)
+	case slow && l.level >= gormlogger.Warn:
+		l.log.Warn(ctx, "Slow database query", append(l.queryFields(fc, elapsed), zap.Duration("db.slow_threshold", l.slowThreshold))...)
+	case l.level >= gormlogger.Info:
+		l.log.Info(ctx, "Database query", l.queryFields(fc, elapsed)...)
+	}
+}
+
+func (l *gormLogger) queryFields(fc func() (string, int64), elapsed time.Duration) []zap.Field {
+	sql, rows := fc()
+	if !l.logParameters {
+		sql = redactParameters(sql)
+	}
+	return []zap.Field{
+		zap.String("db.statement", sql),
+		zap.Int64("db.rows_affected", rows),
+		zap.Duration("db.elapsed", elapsed),
+		zap.String("db.caller", utils.FileWithLineNum()),
+	}
+}
+
+// redactParameters replaces the literal values of the statement by ?
+func redactParameters(sql string) string {
+	return sqlLiterals.ReplaceAllString(sql, "?")
+}
@@ -0,0 +1,79 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// observedLogger is a logger.Logger keeping the entries in memory
+type observedLogger struct {
+	log *zap.Logger
+}
+
+func (l observedLogger) Debug(ctx context.Context, msg string, fields ...zapcore.Field) {
+	l.log.Debug(msg, fields...)
+}
+func (l observedLogger) Info(ctx context.Context, msg string, fields ...zapcore.Field) {
+	l.log.Info(msg, fields...)
+}
+func (l observedLogger) Warn(ctx context.Context, msg string, fields ...zapcore.Field) {
+	l.log.Warn(msg, fields...)
+}
+func (l observedLogger) Error(ctx context.Context, msg string, fields ...zapcore.Field) {
+	l.log.Error(msg, fields...)
+}
+func (l observedLogger) Sync() error { return nil }
+
+func newObservedGormLogger(level gormlogger.LogLevel, logParameters bool) (gormlogger.Interface, *observer.ObservedLogs) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	return &gormLogger{
+		log:           observedLogger{zap.New(core)},
+		level:         level,
+		slowThreshold: 100 * time.Millisecond,
+		logParameters: logParameters,
+	}, logs
+}
+
+func query() (string, int64) {
+	return "SELECT * FROM `users` WHERE name = 'Alice' AND id = 10 LIMIT 1", 1
+}
+
+func TestGormLoggerTrace(t *testing.T) {
+	l, logs := newObservedGormLogger(gormlogger.Warn, false)
+	ctx := context.Background()
+
+	l.Trace(ctx, time.Now(), query, nil)
+	l.Trace(ctx, time.Now(), query, gorm.ErrRecordNotFound)
+	assert.Equal(t, 0, logs.Len())
+
+	l.Trace(ctx, time.Now().Add(-time.Second), query, nil)
+	l.Trace(ctx, time.Now(), query, errors.New("connection refused"))
+
+	entries := logs.All()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "Slow database query", entries[0].Message)
+	assert.Equal(t, zapcore.WarnLevel, entries[0].Level)
+	assert.Equal(t, "Database query failed", entries[1].Message)
+	assert.Equal(t, zapcore.ErrorLevel, entries[1].Level)
+	assert.Equal(t, "SELECT * FROM `users` WHERE name = ? AND id = ? LIMIT ?", entries[1].ContextMap()["db.statement"])
+}
+
+func TestGormLoggerParameters(t *testing.T) {
+	l, logs := newObservedGormLogger(gormlogger.Info, true)
+
+	l.Trace(context.Background(), time.Now(), query, nil)
+	assert.Equal(t, "Database query", logs.All()[0].Message)
+	assert.Contains(t, logs.All()[0].ContextMap()["db.statement"], "'Alice'")
+
+	l.LogMode(gormlogger.Silent).Trace(context.Background(), time.Now(), query, nil)
+	assert.Equal(t, 1, logs.Len())
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/asyncfloat64"
+	"go.opentelemetry.io/otel/metric/instrument/asyncint64"
+	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
+	"go.opentelemetry.io/otel/metric/unit"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"gorm.io/gorm"
+)
+
+const metricsStartKey = "metrics:start"
+
+// metricsPlugin observes the connection pool stats and records the latency
+// of every gorm operation
+type metricsPlugin struct {
+	meter    metric.Meter
+	duration syncfloat64.Histogram
+}
+
+func newMetricsPlugin(meter metric.Meter) *metricsPlugin {
+	return &metricsPlugin{meter: meter}
+}
+
+func (p *metricsPlugin) Name() string {
+	return "metrics"
+}
+
+func (p *metricsPlugin) Initialize(db *gorm.DB) error {
+	duration, err := p.meter.SyncFloat64().Histogram(
+		"db.client.duration",
+		instrument.WithDescription("Duration of the database operations"),
+		instrument.WithUnit(unit.Milliseconds),
+	)
+	if err != nil {
+		return err
+	}
+	p.duration = duration
+
+	cb := db.Callback()
+	hooks := []struct {
+		operation string
+		before    func(string, func(*gorm.DB)) error
+		after     func(string, func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+	for _, h := range hooks {
+		if err := h.before("metrics:before_"+h.operation, p.before); err != nil {
+			return err
+		}
+		if err := h.after("metrics:after_"+h.operation, p.after(h.operation)); err != nil {
+			return err
+		}
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	return registerPoolMetrics(p.meter, sqlDB)
+}
+
+func (p *metricsPlugin) before(tx *gorm.DB) {
+	tx.InstanceSet(metricsStartKey, time.Now())
+}
+
+func (p *metricsPlugin) after(operation string) func(*gorm.DB) {
+	return func(tx *gorm.DB) {
+		v, ok := tx.InstanceGet(metricsStartKey)
+		if !ok {
+			return
+		}
+		start, ok := v.(time.Time)
+		if !ok {
+			return
+		}
+
+		failed := tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound)
+		p.duration.Record(
+			tx.Statement.Context,
+			float64(time.Since(start).Microseconds())/1000,
+			semconv.DBSystemMySQL,
+			semconv.DBOperationKey.String(operation),
+			semconv.DBSQLTableKey.String(tx.Statement.Table),
+			attribute.Bool("error", failed),
+		)
+	}
+}
+
+// registerPoolMetrics exports sql.DBStats, the stats are read once per collection
+func registerPoolMetrics(meter metric.Meter, sqlDB *sql.DB) error {
+	open, err := meter.AsyncInt64().UpDownCounter(
+		"db.client.connections.open",
+		instrument.WithDescription("Number of established connections, both in use and idle"),
+	)
+	if err != nil {
+		return err
+	}
+	usage, err := meter.AsyncInt64().UpDownCounter(
+		"db.client.connections.usage",
+		instrument.WithDescription("Number of connections by state, used or idle"),
+	)
+	if err != nil {
+		return err
+	}
+	maxConns, err := meter.AsyncInt64().UpDownCounter(
+		"db.client.connections.max",
+		instrument.WithDescription("Maximum number of open connections allowed"),
+	)
+	if err != nil {
+		return err
+	}
+	waitCount, err := meter.AsyncInt64().Counter(
+		"db.client.connections.wait_count",
+		instrument.WithDescription("Total number of connections waited for"),
+	)
+	if err != nil {
+		return err
+	}
+	waitDuration, err := meter.AsyncFloat64().Counter(
+		"db.client.connections.wait_duration",
+		instrument.WithDescription("Total time blocked waiting for a new connection"),
+		instrument.WithUnit(unit.Milliseconds),
+	)
+	if err != nil {
+		return err
+	}
+	closedMaxLifetime, err := meter.AsyncInt64().Counter(
+		"db.client.connections.closed_max_lifetime",
+		instrument.WithDescription("Total number of connections closed due to SetConnMaxLifetime"),
+	)
+	if err != nil {
+		return err
+	}
+
+	insts := []instrument.Asynchronous{open, usage, maxConns, waitCount, waitDuration, closedMaxLifetime}
+	err = meter.RegisterCallback(insts, func(ctx context.Context) {
+		observePoolStats(ctx, sqlDB.Stats(), open, usage, maxConns, waitCount, waitDuration, closedMaxLifetime)
+	})
+	if err != nil {
+		return fmt.Errorf("Cannot register pool metrics: %w", err)
+	}
+	return nil
+}
+
+func observePoolStats(
+	ctx context.Context,
+	stats sql.DBStats,
+	open, usage, maxConns asyncint64.UpDownCounter,
+	waitCount asyncint64.Counter,
+	waitDuration asyncfloat64.Counter,
+	closedMaxLifetime asyncint64.Counter,
+) {
+	open.Observe(ctx, int64(stats.OpenConnections), semconv.DBSystemMySQL)
+	usage.Observe(ctx, int64(stats.InUse), semconv.DBSystemMySQL, attribute.String("state", "used"))
+	usage.Observe(ctx, int64(stats.Idle), semconv.DBSystemMySQL, attribute.String("state", "idle"))
+	maxConns.Observe(ctx, int64(stats.MaxOpenConnections), semconv.DBSystemMySQL)
+	waitCount.Observe(ctx, stats.WaitCount, semconv.DBSystemMySQL)
+	waitDuration.Observe(ctx, float64(stats.WaitDuration.Microseconds())/1000, semconv.DBSystemMySQL)
+	closedMaxLifetime.Observe(ctx, stats.MaxLifetimeClosed, semconv.DBSystemMySQL)
+}
@@ -0,0 +1,66 @@
+package db
+
+import (
+	"context"
+	"prom/app/otel/oteltest"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// sumValues returns the value of the data points of a sum by their state attribute
+func sumValues(metric *metricspb.Metric) map[string]int64 {
+	values := make(map[string]int64)
+	for _, dp := range metric.GetSum().GetDataPoints() {
+		state, _ := oteltest.Attribute(dp.Attributes, "state")
+		values[state] = dp.GetAsInt()
+	}
+	return values
+}
+
+func TestPoolMetrics(t *testing.T) {
+	receiver := oteltest.NewReceiver(t)
+	ctx := context.Background()
+
+	exporter, err := otlpmetricgrpc.New(ctx,
+		otlpmetricgrpc.WithEndpoint(receiver.Addr()),
+		otlpmetricgrpc.WithInsecure(),
+	)
+	assert.NoError(t, err)
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)))
+	defer provider.Shutdown(ctx)
+
+	conn, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Use(newMetricsPlugin(provider.Meter("test"))))
+
+	sqlDB, err := conn.DB()
+	assert.NoError(t, err)
+	sqlDB.SetMaxOpenConns(4)
+	sqlDB.SetMaxIdleConns(4)
+
+	// Keep one connection in use and release another one to the idle pool
+	used, err := sqlDB.Conn(ctx)
+	assert.NoError(t, err)
+	defer used.Close()
+	idle, err := sqlDB.Conn(ctx)
+	assert.NoError(t, err)
+	assert.NoError(t, idle.Close())
+
+	assert.NoError(t, provider.ForceFlush(ctx))
+
+	assert.Equal(t, map[string]int64{"": 2}, sumValues(receiver.WaitForMetric(t, "db.client.connections.open", 5*time.Second)))
+	assert.Equal(t, map[string]int64{"used": 1, "idle": 1}, sumValues(receiver.WaitForMetric(t, "db.client.connections.usage", 5*time.Second)))
+	assert.Equal(t, map[string]int64{"": 4}, sumValues(receiver.WaitForMetric(t, "db.client.connections.max", 5*time.Second)))
+	assert.Equal(t, map[string]int64{"": 0}, sumValues(receiver.WaitForMetric(t, "db.client.connections.wait_count", 5*time.Second)))
+
+	system, _ := oteltest.Attribute(receiver.WaitForMetric(t, "db.client.connections.open", 5*time.Second).GetSum().GetDataPoints()[0].Attributes, "db.system")
+	assert.Equal(t, "mysql", system)
+}
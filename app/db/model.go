@@ -14,6 +14,50 @@ type Base struct {
 
 type User struct {
 	Base
-	Id   int    `yaml:"id"   json:"id"   gorm:"primaryKey"`
-	Name string `yaml:"name" json:"name" validate:"required,min=10,max=50"`
+	Id       int    `yaml:"id"        json:"id"        gorm:"primaryKey"`
+	Name     string `yaml:"name"      json:"name"      validate:"required,min=10,max=50"`
+	// Set from the tenant of the request, every query is scoped to it
+	TenantID string `yaml:"tenant_id" json:"tenant_id" gorm:"size:64;index"`
+}
+
+// ApiKey authenticates the service to service callers, only the sha256 of
+// the key is stored. A revoked key is soft deleted
+type ApiKey struct {
+	Base
+	Id         int        `yaml:"id"           json:"id"           gorm:"primaryKey"`
+	Name       string     `yaml:"name"         json:"name"         validate:"required,max=100"`
+	Prefix     string     `yaml:"prefix"       json:"prefix"       gorm:"size:16;uniqueIndex"`
+	Hash       string     `yaml:"-"            json:"-"            gorm:"size:64"`
+	Scopes     []string   `yaml:"scopes"       json:"scopes"       gorm:"serializer:json"`
+	ExpiresAt  *time.Time `yaml:"expires_at"   json:"expires_at"`
+	LastUsedAt *time.Time `yaml:"last_used_at" json:"last_used_at"`
+	// Tenant of the principal authenticated by the key, empty for none e.g. the
+	// bootstrap admin key
+	TenantID   string     `yaml:"tenant_id"    json:"tenant_id"    gorm:"size:64"`
+}
+
+// The keys are looked up before the tenant of the request is known
+func (ApiKey) tenantUnscoped() {}
+
+// RateLimitBucket is the state of a rate limit key shared by the replicas
+type RateLimitBucket struct {
+	Bucket    string    `gorm:"primaryKey;size:191"`
+	Value     float64
+	Prev      float64
+	StampNano int64
+	ExpiresAt time.Time `gorm:"index"`
+}
+
+// IdempotencyKey is a request processed under an Idempotency-Key, Status is 0
+// while the request is in flight
+type IdempotencyKey struct {
+	Key         string    `gorm:"primaryKey;size:64"`
+	Fingerprint string    `gorm:"size:64"`
+	// Owner of the lock, a request whose lock was taken over can't write the key
+	Token       string    `gorm:"size:32"`
+	Status      int
+	ContentType string    `gorm:"size:255"`
+	Body        []byte
+	LockedUntil time.Time
+	ExpiresAt   time.Time `gorm:"index"`
 }
@@ -6,22 +6,15 @@ import (
 
 	"gorm.io/driver/mysql"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
-	"gorm.io/plugin/opentelemetry/logging/logrus"
+	gormlogger "gorm.io/gorm/logger"
 	"gorm.io/plugin/opentelemetry/tracing"
+	"prom/app/otel"
 	"prom/core/domain/repository"
 )
 
-func New(conn string) (repository.Connection, error) {
-	// TODO change this to a custom logger
-	logger := logger.New(
-		logrus.NewWriter(),
-		logger.Config{
-			SlowThreshold: time.Second,
-			LogLevel:      logger.Warn,
-			Colorful:      false,
-		},
-	)
+// New connects to mysql, with requireTenant the queries of the tenanted models
+// fail without a tenant in their context
+func New(conn string, logger gormlogger.Interface, requireTenant bool) (repository.Connection, error) {
 	db, err := gorm.Open(mysql.Open(conn), &gorm.Config{Logger: logger})
 	if err != nil {
 		return nil, fmt.Errorf("Cannot connect to db: %w", err)
@@ -38,22 +31,36 @@ func New(conn string) (repository.Connection, error) {
 		return nil, fmt.Errorf("Cannot create database: %w", tx.Error)
 	}
 
+	return Setup(db, requireTenant)
+}
+
+// Setup migrates the models, instruments an open connection and scopes the
+// queries to the tenant of their context
+func Setup(db *gorm.DB, requireTenant bool) (repository.Connection, error) {
 	// Init models
-	db.AutoMigrate(&User{})
+	db.AutoMigrate(&User{}, &ApiKey{}, &RateLimitBucket{}, &IdempotencyKey{})
+
+	if err := db.Use(newTenantPlugin(requireTenant)); err != nil {
+		return nil, fmt.Errorf("Cannot initialize tenant scoping for gorm: %w", err)
+	}
+
+	if err := db.Use(tracing.NewPlugin(tracing.WithoutQueryVariables())); err != nil {
+		return nil, fmt.Errorf("Cannot initialize tracing for gorm: %w", err)
+	}
 
-	if err := db.Use(tracing.NewPlugin()); err != nil {
-		return nil, fmt.Errorf("Cannot initialize tracing for gorm: %w", tx.Error)
+	if err := db.Use(newMetricsPlugin(otel.GetMeterInstance())); err != nil {
+		return nil, fmt.Errorf("Cannot initialize metrics for gorm: %w", err)
 	}
 
   // TODO add config for these options
   sqlDB, err := db.DB()
-	sqlDB.SetMaxIdleConns(10)
-	sqlDB.SetMaxOpenConns(100)
-	sqlDB.SetConnMaxLifetime(time.Hour)
-
 	if err != nil {
 		return nil, fmt.Errorf("Cannot get sqldb: %w", err)
 	}
 
+	sqlDB.SetMaxIdleConns(10)
+	sqlDB.SetMaxOpenConns(100)
+	sqlDB.SetConnMaxLifetime(time.Hour)
+
 	return db, nil
 }
@@ -0,0 +1,119 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"prom/core/domain/tenancy"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const tenantField = "TenantID"
+
+var ErrMissingTenant = errors.New("The query has no tenant")
+
+// tenantUnscoped is implemented by the models whose TenantID is an attribute
+// of the row rather than its owner, they are not scoped
+type tenantUnscoped interface {
+	tenantUnscoped()
+}
+
+// tenantPlugin scopes every query on a model with a TenantID to the tenant of
+// the statement context, the created rows are assigned to it. The raw queries
+// are not scoped. When required, the queries without a tenant fail
+type tenantPlugin struct {
+	required bool
+}
+
+func newTenantPlugin(required bool) *tenantPlugin {
+	return &tenantPlugin{required: required}
+}
+
+func (p *tenantPlugin) Name() string {
+	return "tenant"
+}
+
+func (p *tenantPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	hooks := []struct {
+		name     string
+		register func(string, func(*gorm.DB)) error
+		fn       func(*gorm.DB)
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, p.assign},
+		{"query", cb.Query().Before("gorm:query").Register, p.scope},
+		{"update", cb.Update().Before("gorm:update").Register, p.scope},
+		{"delete", cb.Delete().Before("gorm:delete").Register, p.scope},
+		{"row", cb.Row().Before("gorm:row").Register, p.scope},
+	}
+	for _, h := range hooks {
+		if err := h.register("tenant:"+h.name, h.fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// field returns the tenant column of the model and the tenant of the context,
+// false when the statement is not scoped
+func (p *tenantPlugin) field(tx *gorm.DB) (*schema.Field, string, bool) {
+	if tx.Statement.Schema == nil {
+		return nil, "", false
+	}
+	if _, ok := reflect.New(tx.Statement.Schema.ModelType).Interface().(tenantUnscoped); ok {
+		return nil, "", false
+	}
+	field := tx.Statement.Schema.LookUpField(tenantField)
+	if field == nil {
+		return nil, "", false
+	}
+	tenant := tenancy.Tenant(tx.Statement.Context)
+	if tenant == "" {
+		if p.required {
+			tx.AddError(fmt.Errorf("%w on %s", ErrMissingTenant, tx.Statement.Schema.Table))
+		}
+		return nil, "", false
+	}
+	return field, tenant, true
+}
+
+func (p *tenantPlugin) scope(tx *gorm.DB) {
+	field, tenant, ok := p.field(tx)
+	if !ok {
+		return
+	}
+	tx.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: tenant},
+	}})
+}
+
+// assign sets the tenant of the created rows, a row of another tenant is refused
+func (p *tenantPlugin) assign(tx *gorm.DB) {
+	field, tenant, ok := p.field(tx)
+	if !ok {
+		return
+	}
+	ctx := tx.Statement.Context
+
+	set := func(row reflect.Value) {
+		if v, zero := field.ValueOf(ctx, row); !zero && v != tenant {
+			tx.AddError(fmt.Errorf("Cannot create a row of tenant %v in tenant %s", v, tenant))
+			return
+		}
+		if err := field.Set(ctx, row, tenant); err != nil {
+			tx.AddError(err)
+		}
+	}
+
+	switch rv := reflect.Indirect(tx.Statement.ReflectValue); rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			set(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		set(rv)
+	}
+}
@@ -0,0 +1,65 @@
+package db
+
+import (
+	"context"
+	"prom/core/domain/tenancy"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTenantDB(t *testing.T) *gorm.DB {
+	conn, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	assert.NoError(t, err)
+	assert.NoError(t, conn.Use(newTenantPlugin(true)))
+	assert.NoError(t, conn.AutoMigrate(&User{}, &ApiKey{}))
+	return conn
+}
+
+func TestTenantScoping(t *testing.T) {
+	conn := newTenantDB(t)
+	acme := tenancy.WithTenant(context.Background(), "acme")
+	globex := tenancy.WithTenant(context.Background(), "globex")
+
+	alice := &User{Name: "Alice Liddell"}
+	assert.NoError(t, conn.WithContext(acme).Create(alice).Error)
+	assert.Equal(t, "acme", alice.TenantID)
+	assert.NoError(t, conn.WithContext(globex).Create([]*User{{Name: "Bob Marley"}, {Name: "Carol Danvers"}}).Error)
+
+	var users []*User
+	assert.NoError(t, conn.WithContext(acme).Find(&users).Error)
+	assert.Len(t, users, 1)
+	assert.NoError(t, conn.WithContext(globex).Find(&users).Error)
+	assert.Len(t, users, 2)
+
+	// Another tenant can't read, update or delete the row even by id
+	tx := conn.WithContext(globex).Where("id = ?", alice.Id).Find(&User{})
+	assert.NoError(t, tx.Error)
+	assert.Zero(t, tx.RowsAffected)
+	tx = conn.WithContext(globex).Where("id = ?", alice.Id).Updates(&User{Name: "Mallory Knox"})
+	assert.NoError(t, tx.Error)
+	assert.Zero(t, tx.RowsAffected)
+	tx = conn.WithContext(globex).Delete(&User{Id: alice.Id})
+	assert.NoError(t, tx.Error)
+	assert.Zero(t, tx.RowsAffected)
+
+	var count int64
+	assert.NoError(t, conn.WithContext(acme).Model(&User{}).Count(&count).Error)
+	assert.Equal(t, int64(1), count)
+
+	// A row can't be created in another tenant
+	assert.Error(t, conn.WithContext(acme).Create(&User{Name: "Dave Lister", TenantID: "globex"}).Error)
+}
+
+func TestTenantRequired(t *testing.T) {
+	conn := newTenantDB(t)
+
+	assert.ErrorIs(t, conn.Find(&[]*User{}).Error, ErrMissingTenant)
+	assert.ErrorIs(t, conn.Create(&User{Name: "Alice Liddell"}).Error, ErrMissingTenant)
+	// The models without a tenant or whose tenant is an attribute are not scoped
+	assert.NoError(t, conn.Find(&[]*ApiKey{}).Error)
+	assert.NoError(t, conn.Create(&ApiKey{Name: "batch", Prefix: "abc", TenantID: "acme"}).Error)
+}
@@ -16,6 +16,81 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
+        "/v1/admin/api-keys": {
+            "get": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List the API keys not revoked",
+                "operationId": "list_api_keys",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/db.ApiKey"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Mints an API key",
+                "operationId": "create_api_key",
+                "parameters": [
+                    {
+                        "description": "API key",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/fbr.CreateApiKeyRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/fbr.CreateApiKeyResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/v1/admin/api-keys/{keyId}": {
+            "delete": {
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Revokes an API key",
+                "operationId": "revoke_api_key",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "keyId",
+                        "name": "keyId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "success",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
         "/v1/user": {
             "get": {
                 "produces": [
@@ -48,6 +123,12 @@ const docTemplate = `{
                         "name": "name",
                         "in": "query",
                         "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Replays the response of a previous request with the same key",
+                        "name": "Idempotency-Key",
+                        "in": "header"
                     }
                 ],
                 "responses": {
@@ -143,6 +224,40 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "db.ApiKey": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "prefix": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "tenant_id": {
+                    "description": "Tenant of the principal authenticated by the key, empty for none e.g. the\nbootstrap admin key",
+                    "type": "string"
+                }
+            }
+        },
         "db.User": {
             "type": "object",
             "required": [
@@ -156,6 +271,47 @@ const docTemplate = `{
                     "type": "string",
                     "maxLength": 50,
                     "minLength": 10
+                },
+                "tenant_id": {
+                    "description": "Set from the tenant of the request, every query is scoped to it",
+                    "type": "string"
+                }
+            }
+        },
+        "fbr.CreateApiKeyRequest": {
+            "type": "object",
+            "required": [
+                "name"
+            ],
+            "properties": {
+                "expires_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string",
+                    "maxLength": 100
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "tenant_id": {
+                    "description": "Only a caller without a tenant can pick it, the key of a caller with one\nbelongs to its tenant",
+                    "type": "string"
+                }
+            }
+        },
+        "fbr.CreateApiKeyResponse": {
+            "type": "object",
+            "properties": {
+                "api_key": {
+                    "$ref": "#/definitions/db.ApiKey"
+                },
+                "key": {
+                    "description": "Only returned once, the key can't be read back",
+                    "type": "string"
                 }
             }
         }
@@ -0,0 +1,87 @@
+package fbr
+
+import (
+	"math/rand"
+	"prom/app/config"
+	"prom/core/domain/auth"
+	"prom/core/domain/logger"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"go.uber.org/zap"
+)
+
+// accessLog writes one line per request, the successful requests are sampled
+// while the client and server errors and the slow requests are always logged
+type accessLog struct {
+	log         logger.Logger
+	sampleRatio float64
+	slow        time.Duration
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newAccessLog(log logger.Logger, conf *config.AppConfig) *accessLog {
+	return &accessLog{
+		log:         log,
+		sampleRatio: conf.AccessLogSampleRatio,
+		slow:        conf.AccessLogSlowThreshold,
+		rand:        rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (a *accessLog) sampled() bool {
+	if a.sampleRatio >= 1 {
+		return true
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.rand.Float64() < a.sampleRatio
+}
+
+// Middleware must be registered after the request id and otelfiber middlewares
+// so the lines carry both ids, and before recover to log the panics
+func (a *accessLog) Middleware(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+	latency := time.Since(start)
+	status := responseStatus(c, err)
+
+	slow := a.slow > 0 && latency > a.slow
+	if status < fiber.StatusBadRequest && !slow && !a.sampled() {
+		return err
+	}
+
+	// The fields may be written after the request buffers are reused by the
+	// next request, e.g. by the otlp exporter, the zero-copy values are copied
+	fields := []zap.Field{
+		zap.String("http.method", utils.CopyString(c.Method())),
+		zap.String("http.route", c.Route().Path),
+		zap.Int("http.status_code", status),
+		zap.Float64("http.duration_ms", float64(latency.Microseconds())/1000),
+		zap.Int("http.response_size", len(c.Response().Body())),
+		zap.String("http.client_ip", c.IP()),
+		zap.String("http.user_agent", utils.CopyString(c.Get(fiber.HeaderUserAgent))),
+	}
+
+	ctx := c.UserContext()
+	if principal := auth.PrincipalFrom(ctx); principal != nil {
+		fields = append(fields, zap.String("enduser.id", principal.Subject))
+	}
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+
+	switch {
+	case status >= fiber.StatusInternalServerError:
+		a.log.Error(ctx, "HTTP request", fields...)
+	case status >= fiber.StatusBadRequest || slow:
+		a.log.Warn(ctx, "HTTP request", append(fields, zap.Bool("http.slow", slow))...)
+	default:
+		a.log.Info(ctx, "HTTP request", fields...)
+	}
+	return err
+}
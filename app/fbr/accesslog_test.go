@@ -0,0 +1,117 @@
+package fbr
+
+import (
+	"context"
+	"net/http/httptest"
+	"prom/app/config"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// observedLogger is a logger.Logger keeping the entries in memory
+type observedLogger struct {
+	log *zap.Logger
+}
+
+func (l observedLogger) Debug(ctx context.Context, msg string, fields ...zapcore.Field) {
+	l.log.Debug(msg, fields...)
+}
+func (l observedLogger) Info(ctx context.Context, msg string, fields ...zapcore.Field) {
+	l.log.Info(msg, fields...)
+}
+func (l observedLogger) Warn(ctx context.Context, msg string, fields ...zapcore.Field) {
+	l.log.Warn(msg, fields...)
+}
+func (l observedLogger) Error(ctx context.Context, msg string, fields ...zapcore.Field) {
+	l.log.Error(msg, fields...)
+}
+func (l observedLogger) Sync() error { return nil }
+
+func TestAccessLog(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	access := newAccessLog(observedLogger{zap.New(core)}, &config.AppConfig{
+		AccessLogSampleRatio:   0,
+		AccessLogSlowThreshold: 50 * time.Millisecond,
+	})
+
+	app := fiber.New()
+	app.Use(access.Middleware)
+	app.Get("/v1/user/:id", func(c *fiber.Ctx) error {
+		switch c.Params("id") {
+		case "0":
+			return fiber.ErrInternalServerError
+		case "404":
+			return c.Status(fiber.StatusNotFound).SendString("not found")
+		case "slow":
+			time.Sleep(60 * time.Millisecond)
+		}
+		return c.SendString("ok")
+	})
+
+	for _, target := range []string{"/v1/user/1", "/v1/user/0", "/v1/user/404", "/v1/user/slow"} {
+		_, err := app.Test(httptest.NewRequest("GET", target, nil))
+		assert.NoError(t, err)
+	}
+
+	// The successful request is not sampled
+	entries := logs.All()
+	assert.Len(t, entries, 3)
+
+	assert.Equal(t, zapcore.ErrorLevel, entries[0].Level)
+	fields := entries[0].ContextMap()
+	assert.Equal(t, "/v1/user/:id", fields["http.route"])
+	assert.Equal(t, int64(500), fields["http.status_code"])
+	assert.Equal(t, "GET", fields["http.method"])
+
+	assert.Equal(t, zapcore.WarnLevel, entries[1].Level)
+	assert.Equal(t, int64(404), entries[1].ContextMap()["http.status_code"])
+
+	assert.Equal(t, zapcore.WarnLevel, entries[2].Level)
+	assert.Equal(t, true, entries[2].ContextMap()["http.slow"])
+}
+
+func TestAccessLogOutlivesRequest(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	access := newAccessLog(observedLogger{zap.New(core)}, &config.AppConfig{AccessLogSampleRatio: 1})
+
+	app := fiber.New()
+	app.Use(access.Middleware)
+	app.All("/v1/user", func(c *fiber.Ctx) error {
+		return c.SendString("ok")
+	})
+
+	for _, r := range []struct{ method, agent string }{{"GET", "agent/1.0"}, {"PUT", "agent/2.0"}} {
+		req := httptest.NewRequest(r.method, "/v1/user", nil)
+		req.Header.Set(fiber.HeaderUserAgent, r.agent)
+		_, err := app.Test(req)
+		assert.NoError(t, err)
+	}
+
+	entries := logs.All()
+	assert.Len(t, entries, 2)
+	assert.Equal(t, "GET", entries[0].ContextMap()["http.method"])
+	assert.Equal(t, "agent/1.0", entries[0].ContextMap()["http.user_agent"])
+	assert.Equal(t, "PUT", entries[1].ContextMap()["http.method"])
+	assert.Equal(t, "agent/2.0", entries[1].ContextMap()["http.user_agent"])
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	access := newAccessLog(observedLogger{zap.New(core)}, &config.AppConfig{AccessLogSampleRatio: 1})
+
+	app := fiber.New()
+	app.Use(access.Middleware)
+	app.Get("/", func(c *fiber.Ctx) error { return c.SendString("ok") })
+
+	_, err := app.Test(httptest.NewRequest("GET", "/", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, logs.Len())
+	assert.Equal(t, zapcore.InfoLevel, logs.All()[0].Level)
+	assert.Equal(t, int64(2), logs.All()[0].ContextMap()["http.response_size"])
+}
@@ -0,0 +1,65 @@
+package fbr
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"prom/app/config"
+	"prom/core/domain/logger"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+// InitAdminAdapter registers the operational endpoints served apart from the
+// public routes, it returns false when there is nothing to serve in the admin port
+func InitAdminAdapter(admin *fiber.App, conf *config.AppConfig, log logger.Logger) bool {
+	enabled := false
+
+	// Only when the logger implementation supports changing the level at runtime
+	if leveled, ok := log.(interface{ LevelHandler() http.Handler }); ok {
+		level := fasthttpadaptor.NewFastHTTPHandler(leveled.LevelHandler())
+		admin.Get("/log/level", func(c *fiber.Ctx) error {
+			level(c.Context())
+			return nil
+		})
+		// Anyone reaching the admin port could flood the logs with debug lines
+		if conf.AdminLogLevelWritable {
+			admin.Put("/log/level", func(c *fiber.Ctx) error {
+				level(c.Context())
+				return nil
+			})
+		}
+		enabled = true
+	}
+
+	if conf.MetricsExporterEnabled("prometheus") {
+		metrics := fasthttpadaptor.NewFastHTTPHandler(promhttp.Handler())
+		admin.Get("/metrics", func(c *fiber.Ctx) error {
+			metrics(c.Context())
+			return nil
+		})
+		enabled = true
+	}
+
+	return enabled
+}
+
+// ServeAdmin serves the admin adapter in plain http on the admin port
+func ServeAdmin(admin *fiber.App, conf *config.AppConfig) (*Server, error) {
+	ln, err := net.Listen(admin.Config().Network, fmt.Sprintf(":%s", conf.AdminPort))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot listen on admin port %s: %w", conf.AdminPort, err)
+	}
+
+	s := &Server{
+		app:  admin,
+		errs: make(chan error, 1),
+	}
+	go func() {
+		s.errs <- admin.Listener(ln)
+	}()
+
+	return s, nil
+}
@@ -0,0 +1,65 @@
+package fbr
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"prom/app/config"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestAdminAdapterMetrics(t *testing.T) {
+	admin := fiber.New()
+	assert.False(t, InitAdminAdapter(admin, &config.AppConfig{MetricsExporters: []string{"otlp"}}, nil))
+
+	admin = fiber.New()
+	assert.True(t, InitAdminAdapter(admin, &config.AppConfig{MetricsExporters: []string{"otlp", "prometheus"}}, nil))
+
+	resp, err := admin.Test(httptest.NewRequest("GET", "/metrics", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "go_goroutines")
+}
+
+type leveledLogger struct {
+	observedLogger
+	level zap.AtomicLevel
+}
+
+func (l leveledLogger) LevelHandler() http.Handler {
+	return l.level
+}
+
+func TestAdminAdapterLogLevel(t *testing.T) {
+	core, _ := observer.New(zapcore.DebugLevel)
+	log := leveledLogger{observedLogger{zap.New(core)}, zap.NewAtomicLevelAt(zapcore.InfoLevel)}
+	put := func(admin *fiber.App) int {
+		req := httptest.NewRequest("PUT", "/log/level", strings.NewReader(`{"level":"debug"}`))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, err := admin.Test(req)
+		assert.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	// Read only by default
+	admin := fiber.New()
+	assert.True(t, InitAdminAdapter(admin, &config.AppConfig{}, log))
+	resp, err := admin.Test(httptest.NewRequest("GET", "/log/level", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, fiber.StatusMethodNotAllowed, put(admin))
+	assert.Equal(t, zapcore.InfoLevel, log.level.Level())
+
+	admin = fiber.New()
+	assert.True(t, InitAdminAdapter(admin, &config.AppConfig{AdminLogLevelWritable: true}, log))
+	assert.Equal(t, fiber.StatusOK, put(admin))
+	assert.Equal(t, zapcore.DebugLevel, log.level.Level())
+}
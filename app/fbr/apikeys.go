@@ -0,0 +1,148 @@
+package fbr
+
+import (
+	"errors"
+	"net/http"
+	"prom/app/db"
+	"prom/core/domain/auth"
+	"prom/core/domain/logger"
+	"prom/core/domain/repository"
+	"prom/core/usecases"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+type CreateApiKeyRequest struct {
+	Name      string     `json:"name"       validate:"required,max=100"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	// Only a caller without a tenant can pick it, the key of a caller with one
+	// belongs to its tenant
+	TenantID string `json:"tenant_id"`
+}
+
+type CreateApiKeyResponse struct {
+	// Only returned once, the key can't be read back
+	Key    string     `json:"key"`
+	ApiKey *db.ApiKey `json:"api_key"`
+}
+
+// Create API Key
+// @Summary Mints an API key
+// @Id create_api_key
+// @version 1.0
+// @accept application/json
+// @produce application/json
+// @Param request body CreateApiKeyRequest true "API key"
+// @Success 200 {object} CreateApiKeyResponse
+// @Router /v1/admin/api-keys [post]
+// Create API Key Handler
+func CreateApiKey(c *fiber.Ctx, repo repository.Connection, policy *auth.Policy, log logger.Logger) error {
+	req := CreateApiKeyRequest{}
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(http.StatusBadRequest).JSON(err)
+	}
+
+	errors := ValidateStruct(req)
+	if errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON([]*ErrorResponse{{
+			FailedField: "expires_at",
+			Tag:         "The expiration must be in the future",
+			Value:       req.ExpiresAt.Format(time.RFC3339),
+		}})
+	}
+	var unknown []*ErrorResponse
+	for _, scope := range req.Scopes {
+		if !auth.ValidScope(scope) {
+			unknown = append(unknown, &ErrorResponse{FailedField: "scopes", Tag: "Unknown scope", Value: scope})
+		}
+	}
+	if unknown != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(unknown)
+	}
+	if req.TenantID != "" && !validTenantID(req.TenantID) {
+		return c.Status(fiber.StatusBadRequest).JSON([]*ErrorResponse{{
+			FailedField: "tenant_id",
+			Tag:         "Invalid tenant",
+			Value:       req.TenantID,
+		}})
+	}
+
+	ctx := c.UserContext()
+	key, raw, err := usecases.CreateApiKey(repo, policy, ctx, &db.ApiKey{
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		ExpiresAt: req.ExpiresAt,
+		TenantID:  req.TenantID,
+	})
+	if err != nil {
+		if status := deniedStatus(err); status != 0 {
+			return c.Status(status).JSON(err)
+		}
+		log.Error(ctx, "Error creating API key")
+		return c.Status(http.StatusInternalServerError).JSON(err)
+	}
+
+	return c.Status(http.StatusOK).JSON(CreateApiKeyResponse{Key: raw, ApiKey: key})
+}
+
+// List API Keys
+// @Summary List the API keys not revoked
+// @Id list_api_keys
+// @version 1.0
+// @produce application/json
+// @Success 200 {object} []db.ApiKey
+// @Router /v1/admin/api-keys [get]
+// List API Keys Handler
+func ListApiKeys(c *fiber.Ctx, repo repository.Connection, policy *auth.Policy, log logger.Logger) error {
+	ctx := c.UserContext()
+	keys, err := usecases.ListApiKeys(repo, policy, ctx)
+
+	if err != nil {
+		if status := deniedStatus(err); status != 0 {
+			return c.Status(status).JSON(err)
+		}
+		log.Error(ctx, "Error Listing API keys")
+		return c.Status(http.StatusInternalServerError).JSON(err)
+	}
+
+	return c.Status(http.StatusOK).JSON(keys)
+}
+
+// Revoke API Key
+// @Summary Revokes an API key
+// @Id revoke_api_key
+// @version 1.0
+// @produce application/json
+// @Success 200 {string} string "success"
+// @Param keyId path int true "keyId"
+// @Router /v1/admin/api-keys/{keyId} [delete]
+// Revoke API Key Handler
+func RevokeApiKey(c *fiber.Ctx, repo repository.Connection, policy *auth.Policy, log logger.Logger) error {
+	id, err := c.ParamsInt("keyId")
+	if err != nil {
+		return c.Status(http.StatusBadRequest).JSON(err)
+	}
+	ctx := c.UserContext()
+
+	err = usecases.RevokeApiKey(repo, policy, ctx, id)
+	if err != nil {
+		if status := deniedStatus(err); status != 0 {
+			return c.Status(status).JSON(err)
+		}
+		switch {
+		case errors.Is(err, usecases.ApiKeyNotFoundError):
+			return c.Status(http.StatusNotFound).JSON(err)
+		default:
+			log.Error(ctx, "Error revoking API key with id", zap.Int("apikey-id", id))
+			return c.Status(http.StatusInternalServerError).JSON(err)
+		}
+	}
+
+	return c.Status(http.StatusOK).SendString("success")
+}
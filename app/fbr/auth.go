@@ -0,0 +1,129 @@
+package fbr
+
+import (
+	"errors"
+	"prom/app/auth"
+	"prom/app/config"
+	"prom/app/db"
+	domainauth "prom/core/domain/auth"
+	"prom/core/domain/logger"
+	"prom/core/domain/repository"
+	"prom/core/usecases"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// authenticator requires a valid bearer token or API key on every route but
+// the skipped ones and stores the caller in the user context
+type authenticator struct {
+	// nil when no JWT keys are configured, only the API keys are accepted then
+	jwt  *auth.JWTVerifier
+	repo repository.Connection
+	skip []string
+	log  logger.Logger
+}
+
+func newAuthenticator(conf *config.AppConfig, repo repository.Connection, log logger.Logger) (*authenticator, error) {
+	a := &authenticator{repo: repo, skip: conf.AuthSkipPaths, log: log}
+	if conf.AuthJWKSFile != "" || conf.AuthJWKSURL != "" || conf.AuthIssuer != "" || conf.AuthHMACSecret != "" {
+		verifier, err := auth.NewJWTVerifier(conf)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = verifier
+	}
+	return a, nil
+}
+
+// Middleware must be registered after otelfiber and the request id so the
+// rejections are traced and logged with the request
+func (a *authenticator) Middleware(c *fiber.Ctx) error {
+	if matchPath(a.skip, c.Path()) {
+		return c.Next()
+	}
+
+	ctx := c.UserContext()
+	scheme, credentials, _ := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	credentials = strings.TrimSpace(credentials)
+
+	var (
+		principal *domainauth.Principal
+		err       error
+	)
+	switch {
+	case credentials == "":
+		c.Set(fiber.HeaderWWWAuthenticate, a.challenge(""))
+		return fiber.NewError(fiber.StatusUnauthorized, "Missing credentials")
+	case strings.EqualFold(scheme, "Bearer") && a.jwt != nil:
+		principal, err = a.jwt.Verify(ctx, credentials)
+	case strings.EqualFold(scheme, "ApiKey"):
+		principal, err = usecases.AuthenticateApiKey(a.repo, ctx, credentials)
+		if err != nil && !errors.Is(err, usecases.InvalidApiKeyError) {
+			a.log.Error(ctx, "Error authenticating API key", zap.Error(err))
+			return fiber.NewError(fiber.StatusInternalServerError, "Cannot authenticate the API key")
+		}
+	default:
+		c.Set(fiber.HeaderWWWAuthenticate, a.challenge(""))
+		return fiber.NewError(fiber.StatusUnauthorized, "Unsupported authorization scheme")
+	}
+	if err != nil {
+		a.log.Warn(ctx, "Rejected credentials", zap.String("auth.scheme", scheme), zap.Error(err))
+		c.Set(fiber.HeaderWWWAuthenticate, a.challenge(`error="invalid_token"`))
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid credentials")
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(
+		semconv.EnduserIDKey.String(principal.Subject),
+		semconv.EnduserRoleKey.String(strings.Join(principal.Roles, ",")),
+		semconv.EnduserScopeKey.String(strings.Join(principal.Scopes, " ")),
+	)
+	c.SetUserContext(domainauth.WithPrincipal(ctx, principal))
+
+	return c.Next()
+}
+
+// challenge lists the accepted schemes in the WWW-Authenticate header
+func (a *authenticator) challenge(params string) string {
+	challenges := []string{"ApiKey"}
+	if a.jwt != nil {
+		bearer := "Bearer"
+		if params != "" {
+			bearer += " " + params
+		}
+		challenges = append([]string{bearer}, challenges...)
+	}
+	return strings.Join(challenges, ", ")
+}
+
+// matchPath matches the path against the patterns, a trailing * matches any suffix
+func matchPath(patterns []string, path string) bool {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if prefix := strings.TrimSuffix(pattern, "*"); prefix != pattern {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if path == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// deniedStatus maps the authorization errors of the usecases to their
+// status, 0 for any other error
+func deniedStatus(err error) int {
+	switch {
+	case errors.Is(err, domainauth.UnauthenticatedError):
+		return fiber.StatusUnauthorized
+	case errors.Is(err, domainauth.ForbiddenError), errors.Is(err, db.ErrMissingTenant):
+		// Without a tenant the caller is not allowed to reach the tenanted data
+		return fiber.StatusForbidden
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,194 @@
+package fbr
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"prom/app/config"
+	"prom/app/db"
+	"prom/core/domain/auth"
+	"prom/core/usecases"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestAuthenticator(t *testing.T) {
+	core, _ := observer.New(zapcore.DebugLevel)
+	authn, err := newAuthenticator(&config.AppConfig{
+		AuthHMACSecret: "secret",
+		AuthAlgorithms: []string{"HS256"},
+		AuthSkipPaths:  []string{"/health/*", "/version"},
+		AuthRolesClaim: "roles",
+	}, nil, observedLogger{zap.New(core)})
+	assert.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(authn.Middleware)
+	app.Get("/health/liveness", func(c *fiber.Ctx) error { return c.SendString("ok") })
+	app.Get("/v1/user", func(c *fiber.Ctx) error {
+		return c.SendString(auth.PrincipalFrom(c.UserContext()).Subject)
+	})
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/health/liveness", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	resp, err = app.Test(httptest.NewRequest("GET", "/v1/user", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "Bearer, ApiKey", resp.Header.Get(fiber.HeaderWWWAuthenticate))
+
+	req := httptest.NewRequest("GET", "/v1/user", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer not-a-jwt")
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "alice",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("secret"))
+	req = httptest.NewRequest("GET", "/v1/user", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+token)
+	resp, err = app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	body := make([]byte, 5)
+	resp.Body.Read(body)
+	assert.Equal(t, "alice", string(body))
+}
+
+func TestAuthenticatorApiKey(t *testing.T) {
+	gormDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Discard})
+	assert.NoError(t, err)
+	assert.NoError(t, gormDB.AutoMigrate(&db.ApiKey{}))
+	core, _ := observer.New(zapcore.DebugLevel)
+	log := observedLogger{zap.New(core)}
+
+	authn, err := newAuthenticator(&config.AppConfig{}, gormDB, log)
+	assert.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(authn.Middleware)
+	policy, err := auth.NewPolicy(true, nil, nil, "")
+	assert.NoError(t, err)
+	app.Get("/v1/admin/api-keys", func(c *fiber.Ctx) error { return ListApiKeys(c, gormDB, policy, log) })
+
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Subject: "1", Scopes: []string{"admin"}})
+	_, admin, err := usecases.CreateApiKey(gormDB, policy, ctx, &db.ApiKey{Name: "admin", Scopes: []string{"admin"}})
+	assert.NoError(t, err)
+	_, reader, err := usecases.CreateApiKey(gormDB, policy, ctx, &db.ApiKey{Name: "reader", Scopes: []string{"user:read"}})
+	assert.NoError(t, err)
+
+	for key, status := range map[string]int{
+		admin:          fiber.StatusOK,
+		reader:         fiber.StatusForbidden,
+		"pk_unknown_x": fiber.StatusUnauthorized,
+	} {
+		req := httptest.NewRequest("GET", "/v1/admin/api-keys", nil)
+		req.Header.Set(fiber.HeaderAuthorization, "ApiKey "+key)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, status, resp.StatusCode)
+	}
+
+	// Bearer tokens are not accepted without JWT keys
+	req := httptest.NewRequest("GET", "/v1/admin/api-keys", nil)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer "+admin)
+	resp, err := app.Test(req)
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, "ApiKey", resp.Header.Get(fiber.HeaderWWWAuthenticate))
+}
+
+func TestAdminRoutesWithoutAuth(t *testing.T) {
+	t.Setenv("SERVICE_NAME", "ms-baselines-golang")
+	t.Setenv("DB_CONNECTION_STRING", "unused")
+	conf, err := config.New()
+	assert.NoError(t, err)
+	assert.False(t, conf.AuthEnabled)
+
+	gormDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Discard})
+	assert.NoError(t, err)
+	repo, err := db.Setup(gormDB, conf.TenancyEnabled)
+	assert.NoError(t, err)
+	policy, err := auth.NewPolicy(conf.AuthEnabled, conf.AuthzRoles, conf.AuthzOwnerActions, conf.AuthIssuer)
+	assert.NoError(t, err)
+	core, _ := observer.New(zapcore.DebugLevel)
+
+	app := fiber.New()
+	assert.NoError(t, InitHttpAdapter(app, conf, repo, policy, observedLogger{zap.New(core)}, &Health{}))
+
+	bootstrap := "pk_bootstrap_" + strings.Repeat("s", 32)
+	assert.NoError(t, usecases.SeedApiKey(repo, context.Background(), "bootstrap", bootstrap))
+
+	cases := map[string]struct {
+		target string
+		key    string
+		status int
+	}{
+		"admin route without key":    {"/v1/admin/api-keys", "", fiber.StatusUnauthorized},
+		"admin route with bootstrap": {"/v1/admin/api-keys", bootstrap, fiber.StatusOK},
+		"user route without key":     {"/v1/user", "", fiber.StatusOK},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.target, nil)
+			if tc.key != "" {
+				req.Header.Set(fiber.HeaderAuthorization, "ApiKey "+tc.key)
+			}
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.status, resp.StatusCode)
+		})
+	}
+}
+
+func TestCreateApiKeyScopes(t *testing.T) {
+	gormDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Discard})
+	assert.NoError(t, err)
+	assert.NoError(t, gormDB.AutoMigrate(&db.ApiKey{}))
+	policy, err := auth.NewPolicy(true, nil, nil, "")
+	assert.NoError(t, err)
+	core, _ := observer.New(zapcore.DebugLevel)
+	log := observedLogger{zap.New(core)}
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(auth.WithPrincipal(c.UserContext(), &auth.Principal{Subject: "1", Scopes: []string{"admin"}}))
+		return c.Next()
+	})
+	app.Post("/v1/admin/api-keys", func(c *fiber.Ctx) error { return CreateApiKey(c, gormDB, policy, log) })
+
+	create := func(body string) (int, string) {
+		req := httptest.NewRequest("POST", "/v1/admin/api-keys", strings.NewReader(body))
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	status, body := create(`{"name":"batch","scopes":["users:read","user:write","everything"]}`)
+	assert.Equal(t, fiber.StatusBadRequest, status)
+	assert.Contains(t, body, `"Value":"users:read"`)
+	assert.Contains(t, body, `"Value":"everything"`)
+	assert.NotContains(t, body, `"Value":"user:write"`)
+	var count int64
+	assert.NoError(t, gormDB.Model(&db.ApiKey{}).Count(&count).Error)
+	assert.Zero(t, count)
+
+	status, _ = create(`{"name":"batch","scopes":["user:read","user:write"]}`)
+	assert.Equal(t, fiber.StatusOK, status)
+}
@@ -1,8 +1,13 @@
 package fbr
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
+	"net"
 	"prom/app/config"
+	appotel "prom/app/otel"
+	"prom/core/domain/auth"
 	"prom/core/domain/logger"
 	"prom/core/domain/repository"
 
@@ -12,21 +17,56 @@ import (
 	"github.com/gofiber/contrib/otelfiber"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/recover"
-	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/otel"
 )
 
-var conf = config.GetConfig()
+func InitHttpAdapter(app *fiber.App, conf *config.AppConfig, userRepo repository.Connection, policy *auth.Policy, log logger.Logger, health *Health) error {
+	metrics, err := newHttpMetrics(appotel.GetMeterInstance())
+	if err != nil {
+		return fmt.Errorf("Cannot create http metrics: %w", err)
+	}
 
-func InitHttpAdapter(app *fiber.App, userRepo repository.Connection, log logger.Logger) {
+	app.Use(otelfiber.Middleware(conf.ServiceName,
+		otelfiber.WithPropagators(otel.GetTextMapPropagator()),
+	))
+	app.Use(RequestIDMiddleware)
+	if conf.AccessLogEnabled {
+		app.Use(newAccessLog(log, conf).Middleware)
+	}
+	// After the access log so the panics are logged as 500s
 	app.Use(recover.New(recover.Config{
     Next: nil,
     EnableStackTrace: true,
     StackTraceHandler: recover.ConfigDefault.StackTraceHandler,
   }))
+	app.Use(ClientIdentityMiddleware)
+	app.Use(metrics.Middleware)
+	var limiter *rateLimiter
+	if conf.RateLimitEnabled {
+		limiter, err = newRateLimiter(conf, userRepo, log)
+		if err != nil {
+			return fmt.Errorf("Cannot set up the rate limits: %w", err)
+		}
+		// Before the authenticator so the rejected credentials are throttled
+		app.Use(limiter.AuthFailuresMiddleware)
+	}
+	authn, err := newAuthenticator(conf, userRepo, log)
+	if err != nil {
+		return fmt.Errorf("Cannot set up the authentication: %w", err)
+	}
+	if conf.AuthEnabled {
+		app.Use(authn.Middleware)
+	}
+	if conf.TenancyEnabled {
+		app.Use(newTenantResolver(conf).Middleware)
+	}
+	if limiter != nil {
+		app.Use(limiter.Middleware)
+	}
 
-	app.Use(otelfiber.Middleware(conf.ServiceName,
-		otelfiber.WithPropagators(xray.Propagator{}),
-	))
+	app.Get("/health/liveness", health.Liveness)
+	app.Get("/health/readiness", health.Readiness)
+	app.Get("/version", Version(appotel.ReadBuildInfo(conf)))
 
 	app.Get("/swagger/*", swagger.New(
 		swagger.Config{
@@ -34,23 +74,140 @@ func InitHttpAdapter(app *fiber.App, userRepo repository.Connection, log logger.
 			DeepLinking: true,
 		},
 	))
-	app.Get("/v1/user", func(c *fiber.Ctx) error {
-		return ListUsers(c, userRepo, log)
-	})
-	app.Get("/v1/user/:id", func(c *fiber.Ctx) error {
-		return GetUser(c, userRepo, log)
-	})
-	app.Post("/v1/user", func(c *fiber.Ctx) error {
-		return CreateUser(c, userRepo, log)
-	})
-	app.Put("/v1/user/:id", func(c *fiber.Ctx) error {
-		return UpdateUser(c, userRepo, log)
-	})
-	app.Delete("/v1/user/:id", func(c *fiber.Ctx) error {
-		return DeleteUser(c, userRepo, log)
-	})
+	app.Get("/v1/user", traced("ListUsersHandler", func(c *fiber.Ctx) error {
+		return ListUsers(c, userRepo, policy, log)
+	}))
+	app.Get("/v1/user/:id", traced("GetUserHandler", func(c *fiber.Ctx) error {
+		return GetUser(c, userRepo, policy, log)
+	}))
+	createUser := []fiber.Handler{traced("CreateUserHandler", func(c *fiber.Ctx) error {
+		return CreateUser(c, userRepo, policy, log)
+	})}
+	if conf.IdempotencyEnabled {
+		// On the route rather than the app so the unmatched requests are not stored
+		createUser = append([]fiber.Handler{newIdempotentRequests(conf, userRepo, log).Middleware}, createUser...)
+	}
+	app.Post("/v1/user", createUser...)
+	app.Put("/v1/user/:id", traced("UpdateUserHandler", func(c *fiber.Ctx) error {
+		return UpdateUser(c, userRepo, policy, log)
+	}))
+	app.Delete("/v1/user/:id", traced("DeleteUserHandler", func(c *fiber.Ctx) error {
+		return DeleteUser(c, userRepo, policy, log)
+	}))
+
+	// The admin action is required to manage the API keys even when AUTH_ENABLED
+	// is false, the callers are then only authenticated on these routes
+	apiKeys := app.Group("/v1/admin/api-keys")
+	if !conf.AuthEnabled {
+		apiKeys.Use(authn.Middleware)
+	}
+	apiKeys.Post("/", traced("CreateApiKeyHandler", func(c *fiber.Ctx) error {
+		return CreateApiKey(c, userRepo, policy, log)
+	}))
+	apiKeys.Get("/", traced("ListApiKeysHandler", func(c *fiber.Ctx) error {
+		return ListApiKeys(c, userRepo, policy, log)
+	}))
+	apiKeys.Delete("/:keyId", traced("RevokeApiKeyHandler", func(c *fiber.Ctx) error {
+		return RevokeApiKey(c, userRepo, policy, log)
+	}))
+
+	return nil
+}
+
+// HttpAdapterConfig only reads the client ip and the forwarded headers of the
+// requests sent by the trusted proxies, c.IP() is the remote address otherwise
+func HttpAdapterConfig(conf *config.AppConfig) fiber.Config {
+	return fiber.Config{
+		// The values returned by the context outlive the request in the user context,
+		// the logs and the spans, they must not be reused by the next requests
+		Immutable:               true,
+		ProxyHeader:             conf.ClientIPHeader,
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          conf.TrustedProxies,
+		// The first valid ip of a list such as X-Forwarded-For
+		EnableIPValidation: true,
+	}
+}
+
+// Server owns the listeners of the http adapter and of the optional http to https redirect
+type Server struct {
+	app      *fiber.App
+	redirect *fiber.App
+	errs     chan error
+}
+
+// Serve binds the ports synchronously so a taken port fails the startup, the
+// listeners errors are received through Err once they stop serving
+func Serve(app *fiber.App, conf *config.AppConfig) (*Server, error) {
+	ln, err := net.Listen(app.Config().Network, fmt.Sprintf(":%s", conf.Port))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot listen on port %s: %w", conf.Port, err)
+	}
+
+	s := &Server{
+		app:  app,
+		errs: make(chan error, 2),
+	}
+
+	if tlsEnabled(conf) {
+		tlsConfig, err := newTLSConfig(conf)
+		if err != nil {
+			ln.Close()
+			return nil, err
+		}
+		ln = tls.NewListener(ln, tlsConfig)
+
+		if conf.HTTPRedirectPort != "" {
+			redirectLn, err := net.Listen(app.Config().Network, fmt.Sprintf(":%s", conf.HTTPRedirectPort))
+			if err != nil {
+				ln.Close()
+				return nil, fmt.Errorf("Cannot listen on redirect port %s: %w", conf.HTTPRedirectPort, err)
+			}
+			s.redirect = newRedirectAdapter(conf)
+			go func() {
+				s.errs <- s.redirect.Listener(redirectLn)
+			}()
+		}
+	}
 
 	go func() {
-		app.Listen(fmt.Sprintf(":%s", conf.Port))
+		s.errs <- app.Listener(ln)
 	}()
+
+	return s, nil
+}
+
+// Err is nil for a nil server so it never fires in a select
+func (s *Server) Err() <-chan error {
+	if s == nil {
+		return nil
+	}
+	return s.errs
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s == nil {
+		return nil
+	}
+	if s.redirect != nil {
+		if err := s.redirect.ShutdownWithContext(ctx); err != nil {
+			return fmt.Errorf("Cannot shutdown redirect adapter: %w", err)
+		}
+	}
+	return s.app.ShutdownWithContext(ctx)
+}
+
+func newRedirectAdapter(conf *config.AppConfig) *fiber.App {
+	redirect := fiber.New(fiber.Config{DisableStartupMessage: true})
+	redirect.Use(func(c *fiber.Ctx) error {
+		host := c.Hostname()
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if conf.Port != "443" {
+			host = net.JoinHostPort(host, conf.Port)
+		}
+		return c.Redirect("https://"+host+string(c.Request().URI().RequestURI()), fiber.StatusPermanentRedirect)
+	})
+	return redirect
 }
@@ -0,0 +1,87 @@
+package fbr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"prom/app/config"
+	appotel "prom/app/otel"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedirectAdapter(t *testing.T) {
+	cases := map[string]struct {
+		port     string
+		location string
+	}{
+		"default https port": {"443", "https://example.com/v1/user?id=1"},
+		"custom https port":  {"8443", "https://example.com:8443/v1/user?id=1"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			redirect := newRedirectAdapter(&config.AppConfig{Port: tc.port})
+			req := httptest.NewRequest("GET", "http://example.com:8080/v1/user?id=1", nil)
+
+			resp, err := redirect.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, fiber.StatusPermanentRedirect, resp.StatusCode)
+			assert.Equal(t, tc.location, resp.Header.Get("Location"))
+		})
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	health := &Health{}
+	app := fiber.New()
+	app.Get("/health/readiness", health.Readiness)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/health/readiness", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusServiceUnavailable, resp.StatusCode)
+
+	health.SetReady(true)
+	resp, err = app.Test(httptest.NewRequest("GET", "/health/readiness", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func TestVersion(t *testing.T) {
+	app := fiber.New()
+	app.Get("/version", Version(appotel.ReadBuildInfo(&config.AppConfig{
+		ServiceName:    "ms-baselines-golang",
+		ServiceVersion: "1.2.3",
+		Environment:    "staging",
+	})))
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/version", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, 200, resp.StatusCode)
+
+	var info appotel.BuildInfo
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	assert.Equal(t, "1.2.3", info.Version)
+	assert.Equal(t, "staging", info.Environment)
+	assert.NotEmpty(t, info.GoVersion)
+}
+
+func TestReadinessDegraded(t *testing.T) {
+	health := &Health{}
+	health.SetReady(true)
+	app := fiber.New()
+	app.Get("/health/readiness", health.Readiness)
+
+	appotel.RecordExport(context.Background(), "traces", 0, errors.New("dial tcp 10.0.0.7:4317: connection refused"))
+	defer appotel.RecordExport(context.Background(), "traces", 0, nil)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/health/readiness", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, "degraded", string(body))
+}
@@ -5,7 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"prom/app/db"
-	"prom/app/otel"
+	"prom/core/domain/auth"
 	"prom/core/domain/logger"
 	"prom/core/domain/repository"
 	"prom/core/usecases"
@@ -22,18 +22,18 @@ import (
 // @Success 200 {object} []db.User
 // @Router /v1/user [get]
 // List Users Handler
-func ListUsers(c *fiber.Ctx, repo repository.Connection, log logger.Logger) error {
-	ctx, span := otel.GetTracerInstance().Start(c.UserContext(), "listUsersHandler")
-	userList, err := usecases.ListUsers(repo, ctx)
-	defer span.End()
+func ListUsers(c *fiber.Ctx, repo repository.Connection, policy *auth.Policy, log logger.Logger) error {
+	ctx := c.UserContext()
+	userList, err := usecases.ListUsers(repo, policy, ctx)
 
 	if err != nil {
+		if status := deniedStatus(err); status != 0 {
+			return c.Status(status).JSON(err)
+		}
 		log.Error(ctx, "Error Listing users")
 		return c.Status(http.StatusInternalServerError).JSON(err)
 	}
 
-	log.Info(ctx, "Listed Users")
-
 	return c.Status(http.StatusOK).JSON(userList)
 }
 
@@ -46,7 +46,7 @@ func ListUsers(c *fiber.Ctx, repo repository.Connection, log logger.Logger) erro
 // @Success 200 {object} db.User
 // @Router /v1/user/{id} [get]
 // Get User Handler
-func GetUser(c *fiber.Ctx, repo repository.Connection, log logger.Logger) error {
+func GetUser(c *fiber.Ctx, repo repository.Connection, policy *auth.Policy, log logger.Logger) error {
 	uid, err := c.ParamsInt("id")
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(err)
@@ -63,11 +63,13 @@ func GetUser(c *fiber.Ctx, repo repository.Connection, log logger.Logger) error
 		return c.Status(http.StatusBadRequest).JSON(inputErrs)
 	}
 
-	ctx, span := otel.GetTracerInstance().Start(c.UserContext(), "GetUserHandler")
-	defer span.End()
-	user, err := usecases.GetUser(repo, ctx, uid)
+	ctx := c.UserContext()
+	user, err := usecases.GetUser(repo, policy, ctx, uid)
 
 	if err != nil {
+		if status := deniedStatus(err); status != 0 {
+			return c.Status(status).JSON(err)
+		}
 		switch {
 		case errors.Is(err, usecases.UserNotFoundError):
 			return c.Status(http.StatusNotFound).JSON(err)
@@ -77,7 +79,6 @@ func GetUser(c *fiber.Ctx, repo repository.Connection, log logger.Logger) error
 		}
 	}
 
-	log.Info(ctx, "Got User with id", zap.Int("uid", uid))
 	return c.Status(http.StatusOK).JSON(user)
 }
 
@@ -88,9 +89,10 @@ func GetUser(c *fiber.Ctx, repo repository.Connection, log logger.Logger) error
 // @produce application/json
 // @Success 200 {object} db.User
 // @Param name query string true "name"
+// @Param Idempotency-Key header string false "Replays the response of a previous request with the same key"
 // @Router /v1/user [post]
 // Create User Handler
-func CreateUser(c *fiber.Ctx, repo repository.Connection, log logger.Logger) error {
+func CreateUser(c *fiber.Ctx, repo repository.Connection, policy *auth.Policy, log logger.Logger) error {
 	name := c.Query("name")
 	user := &db.User{
 		Name: name,
@@ -100,16 +102,17 @@ func CreateUser(c *fiber.Ctx, repo repository.Connection, log logger.Logger) err
 	if errors != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(errors)
 	}
-	ctx, span := otel.GetTracerInstance().Start(c.UserContext(), "CreateUserHandler")
-	defer span.End()
-	userResult, err := usecases.CreateUser(repo, ctx, user)
+	ctx := c.UserContext()
+	userResult, err := usecases.CreateUser(repo, policy, ctx, user)
 
 	if err != nil {
+		if status := deniedStatus(err); status != 0 {
+			return c.Status(status).JSON(err)
+		}
 		log.Error(ctx, "Error creating user with id", zap.String("user-name", name))
 		return c.Status(http.StatusInternalServerError).JSON(err)
 	}
 
-	log.Info(ctx, "Created user with name", zap.String("user-name", name))
 	return c.Status(http.StatusOK).JSON(userResult)
 }
 
@@ -123,7 +126,7 @@ func CreateUser(c *fiber.Ctx, repo repository.Connection, log logger.Logger) err
 // @Param name query string true "name"
 // @Router /v1/user/{id} [put]
 // Update User Handler
-func UpdateUser(c *fiber.Ctx, repo repository.Connection, log logger.Logger) error {
+func UpdateUser(c *fiber.Ctx, repo repository.Connection, policy *auth.Policy, log logger.Logger) error {
 	uid, err := c.ParamsInt("id")
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(err)
@@ -134,10 +137,12 @@ func UpdateUser(c *fiber.Ctx, repo repository.Connection, log logger.Logger) err
 		Id:   uid,
 	}
 
-	ctx, span := otel.GetTracerInstance().Start(c.UserContext(), "UpdateUserHandler")
-	defer span.End()
-	userResult, err := usecases.UpdateUser(repo, ctx, user)
+	ctx := c.UserContext()
+	userResult, err := usecases.UpdateUser(repo, policy, ctx, user)
 	if err != nil {
+		if status := deniedStatus(err); status != 0 {
+			return c.Status(status).JSON(err)
+		}
 		switch {
 		case errors.Is(err, usecases.UserNotFoundError):
 			return c.Status(http.StatusNotFound).JSON(err)
@@ -147,8 +152,6 @@ func UpdateUser(c *fiber.Ctx, repo repository.Connection, log logger.Logger) err
 		}
 	}
 
-	log.Info(ctx, "Updated user with id", zap.Int("uid", uid))
-
 	return c.Status(http.StatusOK).JSON(userResult)
 }
 
@@ -161,20 +164,21 @@ func UpdateUser(c *fiber.Ctx, repo repository.Connection, log logger.Logger) err
 // @Param id path string true "id"
 // @Router /v1/user/{id} [delete]
 // Delete User Handler
-func DeleteUser(c *fiber.Ctx, repo repository.Connection, log logger.Logger) error {
+func DeleteUser(c *fiber.Ctx, repo repository.Connection, policy *auth.Policy, log logger.Logger) error {
 	uid, err := c.ParamsInt("id")
 	if err != nil {
 		return c.Status(http.StatusInternalServerError).JSON(err)
 	}
-	ctx, span := otel.GetTracerInstance().Start(c.UserContext(), "DeleteUserHandler")
-	defer span.End()
+	ctx := c.UserContext()
 
-	err = usecases.DeleteUser(repo, ctx, uid)
+	err = usecases.DeleteUser(repo, policy, ctx, uid)
 	if err != nil {
+		if status := deniedStatus(err); status != 0 {
+			return c.Status(status).JSON(err)
+		}
 	  log.Error(ctx, "Error deleting user with id", zap.Int("uid", uid))
 		return c.Status(http.StatusInternalServerError).JSON(err)
 	}
 
-	log.Info(ctx, "Deleted user with id", zap.Int("uid", uid))
 	return c.Status(http.StatusOK).SendString("success")
 }
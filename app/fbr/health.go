@@ -0,0 +1,60 @@
+package fbr
+
+import (
+	"log"
+	"net/http"
+	appotel "prom/app/otel"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Health keeps the readiness of the service, it is flipped off before draining
+// the http adapter so the load balancer stops sending new requests
+type Health struct {
+	ready atomic.Bool
+
+	mu       sync.Mutex
+	degraded string
+}
+
+func (h *Health) SetReady(ready bool) {
+	h.ready.Store(ready)
+}
+
+func (h *Health) IsReady() bool {
+	return h.ready.Load()
+}
+
+func (h *Health) Liveness(c *fiber.Ctx) error {
+	return c.Status(http.StatusOK).SendString("ok")
+}
+
+// Readiness is not failed by a degraded telemetry, the service keeps serving
+// while the collector is unavailable, the reason is logged and not returned as
+// it may carry the collector address or the errors of the exporters
+func (h *Health) Readiness(c *fiber.Ctx) error {
+	if !h.IsReady() {
+		return c.Status(http.StatusServiceUnavailable).SendString("not ready")
+	}
+	reason := appotel.DegradedReason()
+	h.logDegraded(reason)
+	if reason != "" {
+		return c.Status(http.StatusOK).SendString("degraded")
+	}
+	return c.Status(http.StatusOK).SendString("ok")
+}
+
+// logDegraded logs the reason once per change instead of on every probe
+func (h *Health) logDegraded(reason string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if reason == h.degraded {
+		return
+	}
+	h.degraded = reason
+	if reason != "" {
+		log.Printf("Readiness reports degraded telemetry: %s", reason)
+	}
+}
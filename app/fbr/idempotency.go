@@ -0,0 +1,119 @@
+package fbr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"prom/app/config"
+	"prom/app/idempotency"
+	"prom/core/domain/auth"
+	"prom/core/domain/logger"
+	"prom/core/domain/repository"
+	"prom/core/domain/tenancy"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLen     = 255
+)
+
+// idempotentRequests replays the response of the first request sent with an
+// Idempotency-Key, the failed requests are not stored so they can be retried
+type idempotentRequests struct {
+	store *idempotency.Store
+	log   logger.Logger
+}
+
+func newIdempotentRequests(conf *config.AppConfig, repo repository.Connection, log logger.Logger) *idempotentRequests {
+	return &idempotentRequests{
+		store: idempotency.NewStore(repo, conf.IdempotencyTTL, conf.IdempotencyLockTimeout, conf.IdempotencyWaitTimeout),
+		log:   log,
+	}
+}
+
+// storeKey scopes the key to the tenant and the caller, a client can't
+// replay the response of another one
+func storeKey(c *fiber.Ctx, key string) string {
+	caller := ""
+	if principal := auth.PrincipalFrom(c.UserContext()); principal != nil {
+		caller = principal.Method + ":" + principal.Subject
+	}
+	return hash(tenancy.Tenant(c.UserContext()), caller, key)
+}
+
+// fingerprint identifies the request, the query is part of it as the users
+// are created from query parameters
+func fingerprint(c *fiber.Ctx) string {
+	return hash(c.Method(), c.OriginalURL(), string(c.Body()))
+}
+
+func hash(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		// Length prefixed so the parts can't be shifted between each other
+		h.Write([]byte{byte(len(p) >> 24), byte(len(p) >> 16), byte(len(p) >> 8), byte(len(p))})
+		h.Write([]byte(p))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Middleware must be registered after the authenticator and the tenant
+// resolver to scope the keys, and only on the routes whose responses can be
+// stored: never on a route answering with a secret such as an API key
+func (i *idempotentRequests) Middleware(c *fiber.Ctx) error {
+	key := c.Get(IdempotencyKeyHeader)
+	if key == "" {
+		return c.Next()
+	}
+	if !visibleASCII(key, maxIdempotencyKeyLen) {
+		return fiber.NewError(fiber.StatusBadRequest, "Invalid Idempotency-Key")
+	}
+
+	ctx := c.UserContext()
+	scoped := storeKey(c, key)
+	stored, token, err := i.store.Begin(ctx, scoped, fingerprint(c))
+	switch {
+	case errors.Is(err, idempotency.ErrKeyReused):
+		return fiber.NewError(fiber.StatusConflict, err.Error())
+	case errors.Is(err, idempotency.ErrInFlight):
+		c.Set(fiber.HeaderRetryAfter, "1")
+		return fiber.NewError(fiber.StatusConflict, err.Error())
+	case err != nil:
+		i.log.Error(ctx, "Error beginning idempotent request", zap.Error(err))
+		return fiber.NewError(fiber.StatusServiceUnavailable, "Cannot process the Idempotency-Key")
+	case stored != nil:
+		c.Set(IdempotentReplayedHeader, "true")
+		if stored.ContentType != "" {
+			c.Set(fiber.HeaderContentType, stored.ContentType)
+		}
+		return c.Status(stored.Status).Send(stored.Body)
+	}
+
+	err = c.Next()
+	status := responseStatus(c, err)
+	if err != nil || status >= fiber.StatusInternalServerError {
+		if releaseErr := i.store.Release(ctx, scoped, token); releaseErr != nil {
+			i.log.Error(ctx, "Error releasing idempotency key", zap.Error(releaseErr))
+		}
+		return err
+	}
+
+	completeErr := i.store.Complete(ctx, scoped, token, idempotency.Response{
+		Status:      status,
+		ContentType: string(c.Response().Header.ContentType()),
+		Body:        append([]byte(nil), c.Response().Body()...),
+	})
+	switch {
+	case errors.Is(completeErr, idempotency.ErrLockLost):
+		// A retry took over the key after the lock timeout, its response is the stored one
+		i.log.Warn(ctx, "Idempotent response not stored", zap.Error(completeErr))
+	case completeErr != nil:
+		// The key stays locked until the lock timeout, the retries get a 409 meanwhile
+		i.log.Error(ctx, "Error storing idempotent response", zap.Error(completeErr))
+	}
+	return nil
+}
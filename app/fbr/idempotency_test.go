@@ -0,0 +1,144 @@
+package fbr
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"prom/app/config"
+	"prom/app/db"
+	"prom/core/domain/auth"
+	"prom/core/usecases"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestIdempotentRequests(t *testing.T) {
+	gormDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Discard})
+	assert.NoError(t, err)
+	assert.NoError(t, gormDB.AutoMigrate(&db.IdempotencyKey{}))
+	sqlDB, err := gormDB.DB()
+	assert.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	core, _ := observer.New(zapcore.DebugLevel)
+
+	idempotent := newIdempotentRequests(&config.AppConfig{
+		IdempotencyTTL:         time.Hour,
+		IdempotencyLockTimeout: time.Minute,
+		IdempotencyWaitTimeout: 2 * time.Second,
+	}, gormDB, observedLogger{zap.New(core)})
+
+	var created atomic.Int32
+	app := fiber.New()
+	app.Post("/v1/user", idempotent.Middleware, func(c *fiber.Ctx) error {
+		if c.Query("name") == "fail" {
+			created.Add(1)
+			return fiber.ErrInternalServerError
+		}
+		time.Sleep(100 * time.Millisecond)
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{"id": created.Add(1), "name": c.Query("name")})
+	})
+
+	post := func(key, name string) (*http.Response, string) {
+		req := httptest.NewRequest("POST", "/v1/user?name="+name, nil)
+		req.Header.Set(IdempotencyKeyHeader, key)
+		resp, err := app.Test(req, -1)
+		assert.NoError(t, err)
+		body, _ := io.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	// The concurrent duplicates wait for the first request and replay its response
+	var wg sync.WaitGroup
+	bodies := make([]string, 3)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, body := post("create-alice", "Alice")
+			assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+			bodies[i] = body
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), created.Load())
+	assert.Equal(t, bodies[0], bodies[1])
+	assert.Equal(t, bodies[0], bodies[2])
+
+	resp, body := post("create-alice", "Alice")
+	assert.Equal(t, "true", resp.Header.Get(IdempotentReplayedHeader))
+	assert.Equal(t, fiber.MIMEApplicationJSON, resp.Header.Get(fiber.HeaderContentType))
+	assert.Equal(t, bodies[0], body)
+
+	resp, _ = post("create-alice", "Bob")
+	assert.Equal(t, fiber.StatusConflict, resp.StatusCode)
+
+	// The failures are not stored, the retries run again
+	resp, _ = post("create-fail", "fail")
+	assert.Equal(t, fiber.StatusInternalServerError, resp.StatusCode)
+	post("create-fail", "fail")
+	assert.Equal(t, int32(3), created.Load())
+}
+
+func TestIdempotentRoutes(t *testing.T) {
+	t.Setenv("SERVICE_NAME", "ms-baselines-golang")
+	t.Setenv("DB_CONNECTION_STRING", "unused")
+	t.Setenv("IDEMPOTENCY_ENABLED", "true")
+	conf, err := config.New()
+	assert.NoError(t, err)
+
+	gormDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Discard})
+	assert.NoError(t, err)
+	sqlDB, err := gormDB.DB()
+	assert.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	repo, err := db.Setup(gormDB, conf.TenancyEnabled)
+	assert.NoError(t, err)
+	policy, err := auth.NewPolicy(conf.AuthEnabled, conf.AuthzRoles, conf.AuthzOwnerActions, conf.AuthIssuer)
+	assert.NoError(t, err)
+	core, _ := observer.New(zapcore.DebugLevel)
+
+	app := fiber.New()
+	assert.NoError(t, InitHttpAdapter(app, conf, repo, policy, observedLogger{zap.New(core)}, &Health{}))
+	bootstrap := "pk_bootstrap_" + strings.Repeat("s", 32)
+	assert.NoError(t, usecases.SeedApiKey(repo, context.Background(), "bootstrap", bootstrap))
+
+	cases := map[string]struct {
+		method, target, body string
+		status               int
+	}{
+		"created api key": {"POST", "/v1/admin/api-keys", `{"name":"batch"}`, fiber.StatusOK},
+		"unknown route":   {"POST", "/v1/unknown", "", fiber.StatusNotFound},
+		"wrong method":    {"PATCH", "/v1/user/1", "", fiber.StatusMethodNotAllowed},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			for i := 0; i < 2; i++ {
+				req := httptest.NewRequest(tc.method, tc.target, strings.NewReader(tc.body))
+				req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+				req.Header.Set(fiber.HeaderAuthorization, "ApiKey "+bootstrap)
+				req.Header.Set(IdempotencyKeyHeader, name)
+				resp, err := app.Test(req)
+				assert.NoError(t, err)
+				assert.Equal(t, tc.status, resp.StatusCode)
+				assert.Empty(t, resp.Header.Get(IdempotentReplayedHeader))
+			}
+		})
+	}
+
+	var stored int64
+	assert.NoError(t, gormDB.Model(&db.IdempotencyKey{}).Count(&stored).Error)
+	assert.Zero(t, stored)
+}
@@ -0,0 +1,53 @@
+package fbr
+
+import (
+	"context"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ClientIdentity is the subject of a client certificate verified through mutual TLS
+type ClientIdentity struct {
+	Subject      string
+	CommonName   string
+	Issuer       string
+	SerialNumber string
+}
+
+type clientIdentityKey struct{}
+
+// GetClientIdentity returns the verified client certificate identity of the
+// request, it is nil when mutual TLS is disabled or the client sent no certificate
+func GetClientIdentity(ctx context.Context) *ClientIdentity {
+	id, _ := ctx.Value(clientIdentityKey{}).(*ClientIdentity)
+	return id
+}
+
+// ClientIdentityMiddleware stores the verified client certificate in the user
+// context and in the request span, must be registered after otelfiber
+func ClientIdentityMiddleware(c *fiber.Ctx) error {
+	state := c.Context().TLSConnectionState()
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return c.Next()
+	}
+
+	cert := state.VerifiedChains[0][0]
+	id := &ClientIdentity{
+		Subject:      cert.Subject.String(),
+		CommonName:   cert.Subject.CommonName,
+		Issuer:       cert.Issuer.String(),
+		SerialNumber: cert.SerialNumber.String(),
+	}
+
+	ctx := c.UserContext()
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("tls.client.subject", id.Subject),
+		attribute.String("tls.client.issuer", id.Issuer),
+		attribute.String("tls.client.serial_number", id.SerialNumber),
+	)
+	c.SetUserContext(context.WithValue(ctx, clientIdentityKey{}, id))
+
+	return c.Next()
+}
@@ -0,0 +1,109 @@
+package fbr
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"prom/app/config"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveMutualTLS serves the identity of the client certificate over mutual TLS
+// and returns the url of the listener
+func serveMutualTLS(t *testing.T, ca, server *testCert, clientAuth string) string {
+	dir := t.TempDir()
+	conf := &config.AppConfig{
+		TLSCertFile:       filepath.Join(dir, "tls.crt"),
+		TLSKeyFile:        filepath.Join(dir, "tls.key"),
+		TLSClientCAFile:   filepath.Join(dir, "ca.crt"),
+		TLSClientAuth:     clientAuth,
+		TLSReloadInterval: time.Minute,
+	}
+	writeTestCert(t, conf.TLSCertFile, conf.TLSKeyFile, server, time.Now())
+	assert.NoError(t, os.WriteFile(conf.TLSClientCAFile, ca.pem, 0o600))
+
+	tlsConfig, err := newTLSConfig(conf)
+	assert.NoError(t, err)
+
+	app := fiber.New(fiber.Config{DisableStartupMessage: true})
+	app.Use(ClientIdentityMiddleware)
+	app.Get("/", func(c *fiber.Ctx) error {
+		id := GetClientIdentity(c.UserContext())
+		if id == nil {
+			return c.SendString("anonymous")
+		}
+		return c.SendString(id.CommonName + " " + id.SerialNumber)
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go app.Listener(tls.NewListener(ln, tlsConfig))
+	t.Cleanup(func() { app.Shutdown() })
+
+	return "https://" + ln.Addr().String()
+}
+
+func mutualTLSGet(url string, ca *testCert, certs ...tls.Certificate) (string, error) {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs},
+		},
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestClientIdentityMutualTLS(t *testing.T) {
+	ca := newTestCert(t, "test ca", 1, nil, x509.ExtKeyUsageAny)
+	server := newTestCert(t, "server", 2, ca, x509.ExtKeyUsageServerAuth)
+	client := newTestCert(t, "client", 3, ca, x509.ExtKeyUsageClientAuth)
+	untrustedCA := newTestCert(t, "untrusted ca", 4, nil, x509.ExtKeyUsageAny)
+	untrusted := newTestCert(t, "intruder", 5, untrustedCA, x509.ExtKeyUsageClientAuth)
+
+	t.Run("require", func(t *testing.T) {
+		url := serveMutualTLS(t, ca, server, "require")
+
+		body, err := mutualTLSGet(url, ca, client.tlsCertificate(t))
+		assert.NoError(t, err)
+		assert.Equal(t, "client 3", body)
+
+		_, err = mutualTLSGet(url, ca)
+		assert.Error(t, err, "a client without certificate must be rejected")
+
+		_, err = mutualTLSGet(url, ca, untrusted.tlsCertificate(t))
+		assert.Error(t, err, "a certificate from an unknown CA must be rejected")
+	})
+
+	t.Run("optional", func(t *testing.T) {
+		url := serveMutualTLS(t, ca, server, "optional")
+
+		body, err := mutualTLSGet(url, ca)
+		assert.NoError(t, err)
+		assert.Equal(t, "anonymous", body)
+
+		body, err = mutualTLSGet(url, ca, client.tlsCertificate(t))
+		assert.NoError(t, err)
+		assert.Equal(t, "client 3", body)
+
+		body, err = mutualTLSGet(url, ca, untrusted.tlsCertificate(t))
+		assert.NoError(t, err)
+		assert.Equal(t, "anonymous", body, "a certificate from an unknown CA must not identify the client")
+	})
+}
@@ -0,0 +1,78 @@
+package fbr
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"prom/app/config"
+	"prom/app/db"
+	appotel "prom/app/otel"
+	"prom/app/otel/oteltest"
+	logadapter "prom/app/otel/zapadapter"
+	"prom/core/domain/auth"
+	"testing"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestGetUserTelemetry(t *testing.T) {
+	receiver := oteltest.NewReceiver(t)
+	t.Setenv("SERVICE_NAME", "ms-baselines-golang")
+	t.Setenv("DB_CONNECTION_STRING", "unused")
+	t.Setenv("LOG_EXPORTERS", "otlp")
+	conf, err := config.New()
+	assert.NoError(t, err)
+	assert.Equal(t, receiver.Addr(), conf.OTELCollectorURL)
+
+	ctx := context.Background()
+	shutdownTracer, err := appotel.InitTracer(ctx, conf)
+	assert.NoError(t, err)
+	shutdownMetrics, err := appotel.InitMetricsProvider(ctx, conf)
+	assert.NoError(t, err)
+	log, err := logadapter.NewZapLogger(conf)
+	assert.NoError(t, err)
+
+	gormDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	assert.NoError(t, err)
+	repo, err := db.Setup(gormDB, conf.TenancyEnabled)
+	assert.NoError(t, err)
+	assert.NoError(t, repo.Create(&db.User{Id: 1, Name: "Integration Test"}).Error)
+
+	policy, err := auth.NewPolicy(conf.AuthEnabled, conf.AuthzRoles, conf.AuthzOwnerActions, conf.AuthIssuer)
+	assert.NoError(t, err)
+
+	app := fiber.New()
+	assert.NoError(t, InitHttpAdapter(app, conf, repo, policy, log, &Health{}))
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/v1/user/1", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Shutting down flushes the pending telemetry
+	assert.NoError(t, shutdownTracer(ctx))
+	assert.NoError(t, shutdownMetrics(ctx))
+	assert.NoError(t, log.Sync())
+
+	receiver.WaitForSpan(t, "gorm.Query", 5*time.Second)
+	chain := oteltest.AssertSpanChain(t, receiver.Spans(), "/v1/user/:id", "GetUserHandler", "getUserUC", "gorm.Query")
+	oteltest.AssertSpanAttribute(t, chain[0], "http.status_code", 200)
+	oteltest.AssertSpanAttribute(t, chain[1], "user.id", 1)
+	oteltest.AssertSpanAttribute(t, chain[2], "user.id", 1)
+	oteltest.AssertSpanAttribute(t, chain[2], "db.operation", "select")
+	oteltest.AssertSpanAttribute(t, chain[3], "db.system", "sqlite")
+	oteltest.AssertSpanAttribute(t, chain[3], "db.sql.table", "users")
+
+	receiver.WaitForMetric(t, "http.server.request.count", 5*time.Second)
+	receiver.WaitForMetric(t, "usecase.duration", 5*time.Second)
+
+	record := receiver.WaitForLog(t, "HTTP request", 5*time.Second)
+	assert.Equal(t, hex.EncodeToString(chain[0].TraceId), hex.EncodeToString(record.TraceId))
+	assert.Equal(t, hex.EncodeToString(chain[0].SpanId), hex.EncodeToString(record.SpanId))
+	route, _ := oteltest.Attribute(record.Attributes, "http.route")
+	assert.Equal(t, "/v1/user/:id", route)
+}
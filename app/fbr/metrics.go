@@ -0,0 +1,87 @@
+package fbr
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
+	"go.opentelemetry.io/otel/metric/instrument/syncint64"
+	"go.opentelemetry.io/otel/metric/unit"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// httpMetrics records the RED metrics of the routes: rate, errors and duration
+type httpMetrics struct {
+	requests syncint64.Counter
+	errors   syncint64.Counter
+	duration syncfloat64.Histogram
+}
+
+func newHttpMetrics(meter metric.Meter) (*httpMetrics, error) {
+	requests, err := meter.SyncInt64().Counter(
+		"http.server.request.count",
+		instrument.WithDescription("Number of http requests"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	errs, err := meter.SyncInt64().Counter(
+		"http.server.error.count",
+		instrument.WithDescription("Number of http requests answered with a 5xx status"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := meter.SyncFloat64().Histogram(
+		"http.server.duration",
+		instrument.WithDescription("Duration of the http requests"),
+		instrument.WithUnit(unit.Milliseconds),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &httpMetrics{
+		requests: requests,
+		errors:   errs,
+		duration: duration,
+	}, nil
+}
+
+func (m *httpMetrics) Middleware(c *fiber.Ctx) error {
+	start := time.Now()
+	err := c.Next()
+
+	status := responseStatus(c, err)
+	attrs := []attribute.KeyValue{
+		semconv.HTTPMethodKey.String(c.Method()),
+		semconv.HTTPRouteKey.String(c.Route().Path),
+		semconv.HTTPStatusCodeKey.Int(status),
+	}
+
+	ctx := c.UserContext()
+	m.requests.Add(ctx, 1, attrs...)
+	if status >= fiber.StatusInternalServerError {
+		m.errors.Add(ctx, 1, attrs...)
+	}
+	m.duration.Record(ctx, float64(time.Since(start).Microseconds())/1000, attrs...)
+
+	return err
+}
+
+// responseStatus is the status the client receives, the error handler sets it
+// only after the middlewares have returned
+func responseStatus(c *fiber.Ctx, err error) int {
+	if err == nil {
+		return c.Response().StatusCode()
+	}
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return fiberErr.Code
+	}
+	return fiber.StatusInternalServerError
+}
@@ -0,0 +1,51 @@
+package fbr
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestHttpMetricsMiddleware(t *testing.T) {
+	reader := sdkmetric.NewManualReader()
+	provider := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	metrics, err := newHttpMetrics(provider.Meter("test"))
+	assert.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(metrics.Middleware)
+	app.Get("/v1/user/:id", func(c *fiber.Ctx) error {
+		if c.Params("id") == "0" {
+			return fiber.ErrInternalServerError
+		}
+		return c.SendString("ok")
+	})
+
+	for _, target := range []string{"/v1/user/1", "/v1/user/2", "/v1/user/0"} {
+		_, err := app.Test(httptest.NewRequest("GET", target, nil))
+		assert.NoError(t, err)
+	}
+
+	rm, err := reader.Collect(context.Background())
+	assert.NoError(t, err)
+
+	sums := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			if sum, ok := m.Data.(metricdata.Sum[int64]); ok {
+				for _, dp := range sum.DataPoints {
+					route, _ := dp.Attributes.Value("http.route")
+					assert.Equal(t, "/v1/user/:id", route.AsString())
+					sums[m.Name] += dp.Value
+				}
+			}
+		}
+	}
+	assert.Equal(t, int64(3), sums["http.server.request.count"])
+	assert.Equal(t, int64(1), sums["http.server.error.count"])
+}
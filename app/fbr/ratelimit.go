@@ -0,0 +1,246 @@
+package fbr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"prom/app/config"
+	appotel "prom/app/otel"
+	"prom/app/ratelimit"
+	"prom/core/domain/auth"
+	"prom/core/domain/logger"
+	"prom/core/domain/repository"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/syncint64"
+	"go.uber.org/zap"
+)
+
+const (
+	rateLimitRuleKey    = attribute.Key("ratelimit.rule")
+	rateLimitKeyTypeKey = attribute.Key("ratelimit.key_type")
+	authFailuresRule    = "auth_failures"
+)
+
+type rateLimitRule struct {
+	name   string
+	method string
+	path   string
+	limit  ratelimit.Limit
+}
+
+// rateLimiter throttles the clients per route, the first rule matching the
+// request applies and the default limit otherwise
+type rateLimiter struct {
+	algorithm ratelimit.Algorithm
+	store     ratelimit.Store
+	rules     []rateLimitRule
+	fallback  *rateLimitRule
+	keyBy     []string
+	skip      []string
+	log       logger.Logger
+	throttled syncint64.Counter
+
+	// nil when the rejected credentials are not throttled
+	authFailures *rateLimitRule
+}
+
+func newRateLimiter(conf *config.AppConfig, repo repository.Connection, log logger.Logger) (*rateLimiter, error) {
+	algorithm, err := ratelimit.NewAlgorithm(conf.RateLimitAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	var store ratelimit.Store
+	switch conf.RateLimitStore {
+	case "memory":
+		store = ratelimit.NewMemoryStore()
+	case "mysql":
+		store = ratelimit.NewMySQLStore(repo)
+	default:
+		return nil, fmt.Errorf("Unknown rate limit store %q", conf.RateLimitStore)
+	}
+
+	r := &rateLimiter{algorithm: algorithm, store: store, keyBy: conf.RateLimitKeyBy, skip: conf.RateLimitSkipPaths, log: log}
+	for _, route := range conf.RateLimitRoutes {
+		if strings.TrimSpace(route) == "" {
+			continue
+		}
+		name, limit, ok := strings.Cut(route, "=")
+		method, path, found := strings.Cut(strings.TrimSpace(name), " ")
+		if !ok || !found {
+			return nil, fmt.Errorf("Invalid rate limit route %q, expected METHOD path=requests/window", route)
+		}
+		l, err := ratelimit.ParseLimit(limit)
+		if err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, rateLimitRule{
+			name:   strings.TrimSpace(name),
+			method: strings.ToUpper(method),
+			path:   normalizePath(strings.TrimSpace(path)),
+			limit:  l,
+		})
+	}
+	if conf.RateLimitDefault != "" {
+		l, err := ratelimit.ParseLimit(conf.RateLimitDefault)
+		if err != nil {
+			return nil, err
+		}
+		r.fallback = &rateLimitRule{name: "default", limit: l}
+	}
+	if conf.RateLimitAuthFailures != "" {
+		l, err := ratelimit.ParseLimit(conf.RateLimitAuthFailures)
+		if err != nil {
+			return nil, err
+		}
+		r.authFailures = &rateLimitRule{name: authFailuresRule, limit: l}
+	}
+
+	r.throttled, err = appotel.GetMeterInstance().SyncInt64().Counter(
+		"http.server.throttled_requests",
+		instrument.WithDescription("Number of requests rejected by the rate limits"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Cannot create rate limit metrics: %w", err)
+	}
+
+	return r, nil
+}
+
+// normalizePath matches the paths the way the router does, it ignores the case
+// and a trailing slash
+func normalizePath(path string) string {
+	path = strings.ToLower(path)
+	if trimmed := strings.TrimRight(path, "/"); trimmed != "" {
+		return trimmed
+	}
+	return "/"
+}
+
+func (r *rateLimiter) rule(c *fiber.Ctx) *rateLimitRule {
+	path := normalizePath(c.Path())
+	for i := range r.rules {
+		if r.rules[i].method == c.Method() && matchPath([]string{r.rules[i].path}, path) {
+			return &r.rules[i]
+		}
+	}
+	return r.fallback
+}
+
+// key identifies the client, an API key or a principal are preferred to the
+// ip shared by the clients behind a proxy
+func (r *rateLimiter) key(c *fiber.Ctx) (string, string) {
+	principal := auth.PrincipalFrom(c.UserContext())
+	for _, by := range r.keyBy {
+		switch strings.TrimSpace(by) {
+		case "apikey":
+			if principal != nil && principal.Method == "apikey" {
+				return "apikey", principal.Subject
+			}
+		case "principal":
+			if principal != nil {
+				return "principal", principal.Method + ":" + principal.Subject
+			}
+		case "ip":
+			return "ip", c.IP()
+		}
+	}
+	return "ip", c.IP()
+}
+
+// take counts a request of the client against the rule
+func (r *rateLimiter) take(c *fiber.Ctx, rule *rateLimitRule, key string) (ratelimit.Result, error) {
+	var res ratelimit.Result
+	err := r.store.Update(c.UserContext(), rule.name+"|"+key, r.algorithm.TTL(rule.limit), func(s ratelimit.State) ratelimit.State {
+		s, res = r.algorithm.Take(s, rule.limit, time.Now())
+		return s
+	})
+	return res, err
+}
+
+// peek tells whether a request of the client would be allowed without counting
+// it, the state is only read
+func (r *rateLimiter) peek(c *fiber.Ctx, rule *rateLimitRule, key string) (ratelimit.Result, error) {
+	s, err := r.store.Peek(c.UserContext(), rule.name+"|"+key)
+	if err != nil {
+		return ratelimit.Result{}, err
+	}
+	_, res := r.algorithm.Take(s, rule.limit, time.Now())
+	return res, nil
+}
+
+// Middleware must be registered after the authenticator to key by the caller.
+// The requests are let through when the store fails
+func (r *rateLimiter) Middleware(c *fiber.Ctx) error {
+	if matchPath(r.skip, normalizePath(c.Path())) {
+		return c.Next()
+	}
+	rule := r.rule(c)
+	if rule == nil {
+		return c.Next()
+	}
+
+	ctx := c.UserContext()
+	keyType, client := r.key(c)
+	res, err := r.take(c, rule, keyType+":"+client)
+	if err != nil {
+		r.log.Warn(ctx, "Rate limit not enforced", zap.Error(err))
+		return c.Next()
+	}
+
+	c.Set("RateLimit-Policy", rule.limit.Policy())
+	c.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	c.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	c.Set("RateLimit-Reset", ceilSeconds(res.Reset))
+
+	if !res.Allowed {
+		r.throttled.Add(ctx, 1, rateLimitRuleKey.String(rule.name), rateLimitKeyTypeKey.String(keyType))
+		c.Set(fiber.HeaderRetryAfter, ceilSeconds(res.RetryAfter))
+		return fiber.NewError(fiber.StatusTooManyRequests, "Rate limit exceeded")
+	}
+	return c.Next()
+}
+
+// ceilSeconds rounds up so the clients never retry too early
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// AuthFailuresMiddleware must be registered before the authenticator, the
+// clients are keyed by ip as the rejected ones have no principal. Only the
+// requests answered with a 401 are counted, the others are never throttled
+// until the limit is exhausted
+func (r *rateLimiter) AuthFailuresMiddleware(c *fiber.Ctx) error {
+	if r.authFailures == nil || matchPath(r.skip, normalizePath(c.Path())) {
+		return c.Next()
+	}
+
+	ctx := c.UserContext()
+	key := "ip:" + c.IP()
+	res, err := r.peek(c, r.authFailures, key)
+	if err != nil {
+		r.log.Warn(ctx, "Rate limit of the authentication failures not enforced", zap.Error(err))
+		return c.Next()
+	}
+	if !res.Allowed {
+		r.throttled.Add(ctx, 1, rateLimitRuleKey.String(authFailuresRule), rateLimitKeyTypeKey.String("ip"))
+		c.Set(fiber.HeaderRetryAfter, ceilSeconds(res.RetryAfter))
+		return fiber.NewError(fiber.StatusTooManyRequests, "Too many failed authentications")
+	}
+
+	err = c.Next()
+	var fiberErr *fiber.Error
+	if (errors.As(err, &fiberErr) && fiberErr.Code == fiber.StatusUnauthorized) ||
+		(err == nil && c.Response().StatusCode() == fiber.StatusUnauthorized) {
+		if _, takeErr := r.take(c, r.authFailures, key); takeErr != nil {
+			r.log.Warn(ctx, "Rate limit of the authentication failures not enforced", zap.Error(takeErr))
+		}
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package fbr
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"prom/app/config"
+	"prom/core/domain/auth"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestRateLimiter(t *testing.T) {
+	core, _ := observer.New(zapcore.DebugLevel)
+	limiter, err := newRateLimiter(&config.AppConfig{
+		RateLimitAlgorithm: "token_bucket",
+		RateLimitStore:     "memory",
+		RateLimitRoutes:    []string{"POST /v1/user=2/1m"},
+		RateLimitKeyBy:     []string{"apikey", "principal", "ip"},
+		RateLimitSkipPaths: []string{"/health/*"},
+	}, nil, observedLogger{zap.New(core)})
+	assert.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if key := c.Get("X-Test-ApiKey"); key != "" {
+			c.SetUserContext(auth.WithPrincipal(c.UserContext(), &auth.Principal{Subject: key, Method: "apikey"}))
+		}
+		return c.Next()
+	})
+	app.Use(limiter.Middleware)
+	app.Post("/v1/user", func(c *fiber.Ctx) error { return c.SendString("created") })
+	app.Get("/v1/user", func(c *fiber.Ctx) error { return c.SendString("listed") })
+
+	postPath := func(path, apiKey string) *http.Response {
+		req := httptest.NewRequest("POST", path, nil)
+		if apiKey != "" {
+			req.Header.Set("X-Test-ApiKey", apiKey)
+		}
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp
+	}
+	post := func(apiKey string) *http.Response {
+		return postPath("/v1/user", apiKey)
+	}
+
+	resp := post("")
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	assert.Equal(t, "2", resp.Header.Get("RateLimit-Limit"))
+	assert.Equal(t, "1", resp.Header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "2;w=60", resp.Header.Get("RateLimit-Policy"))
+	assert.Equal(t, fiber.StatusOK, post("").StatusCode)
+
+	resp = post("")
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "0", resp.Header.Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", resp.Header.Get(fiber.HeaderRetryAfter))
+	// The router ignores the case and the trailing slash, so does the rule
+	assert.Equal(t, fiber.StatusTooManyRequests, postPath("/V1/USER/", "").StatusCode)
+
+	// Another client and the routes without a limit are not throttled
+	assert.Equal(t, fiber.StatusOK, post("apikey:abc").StatusCode)
+	list, err := app.Test(httptest.NewRequest("GET", "/v1/user", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusOK, list.StatusCode)
+	assert.Empty(t, list.Header.Get("RateLimit-Limit"))
+}
+
+func TestRateLimiterAuthFailures(t *testing.T) {
+	core, _ := observer.New(zapcore.DebugLevel)
+	limiter, err := newRateLimiter(&config.AppConfig{
+		RateLimitAlgorithm:    "token_bucket",
+		RateLimitStore:        "memory",
+		RateLimitAuthFailures: "2/1m",
+	}, nil, observedLogger{zap.New(core)})
+	assert.NoError(t, err)
+	authn, err := newAuthenticator(&config.AppConfig{}, nil, observedLogger{zap.New(core)})
+	assert.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(limiter.AuthFailuresMiddleware)
+	app.Use(authn.Middleware)
+	app.Get("/v1/user", func(c *fiber.Ctx) error { return c.SendString("listed") })
+
+	get := func() *http.Response {
+		req := httptest.NewRequest("GET", "/v1/user", nil)
+		req.Header.Set(fiber.HeaderAuthorization, "Basic guess")
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp
+	}
+	assert.Equal(t, fiber.StatusUnauthorized, get().StatusCode)
+	assert.Equal(t, fiber.StatusUnauthorized, get().StatusCode)
+
+	// The ip is throttled before its credentials are checked again
+	resp := get()
+	assert.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "30", resp.Header.Get(fiber.HeaderRetryAfter))
+}
+
+func TestRateLimiterClientIP(t *testing.T) {
+	core, _ := observer.New(zapcore.DebugLevel)
+	// The requests of app.Test come from 0.0.0.0
+	for name, tc := range map[string]struct {
+		proxies []string
+		status  int
+	}{
+		"trusted proxy":   {[]string{"0.0.0.0"}, fiber.StatusUnauthorized},
+		"untrusted proxy": {[]string{"10.0.0.0/8"}, fiber.StatusTooManyRequests},
+		"no proxy":        {nil, fiber.StatusTooManyRequests},
+	} {
+		t.Run(name, func(t *testing.T) {
+			conf := &config.AppConfig{
+				RateLimitAlgorithm:    "token_bucket",
+				RateLimitStore:        "memory",
+				RateLimitAuthFailures: "1/1m",
+				ClientIPHeader:        fiber.HeaderXForwardedFor,
+				TrustedProxies:        tc.proxies,
+			}
+			limiter, err := newRateLimiter(conf, nil, observedLogger{zap.New(core)})
+			assert.NoError(t, err)
+			authn, err := newAuthenticator(conf, nil, observedLogger{zap.New(core)})
+			assert.NoError(t, err)
+
+			app := fiber.New(HttpAdapterConfig(conf))
+			app.Use(limiter.AuthFailuresMiddleware)
+			app.Use(authn.Middleware)
+			app.Get("/v1/user", func(c *fiber.Ctx) error { return c.SendString("listed") })
+
+			get := func(ip string) int {
+				req := httptest.NewRequest("GET", "/v1/user", nil)
+				req.Header.Set(fiber.HeaderXForwardedFor, ip+", 10.0.0.1")
+				resp, err := app.Test(req)
+				assert.NoError(t, err)
+				return resp.StatusCode
+			}
+			assert.Equal(t, fiber.StatusUnauthorized, get("203.0.113.1"))
+			assert.Equal(t, fiber.StatusTooManyRequests, get("203.0.113.1"))
+			// Another client behind the proxy has its own limit once the proxy is trusted
+			assert.Equal(t, tc.status, get("203.0.113.2"))
+		})
+	}
+}
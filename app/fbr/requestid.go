@@ -0,0 +1,53 @@
+package fbr
+
+import (
+	"prom/core/domain/logger"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	requestIDKey    = attribute.Key("http.request_id")
+	maxRequestIDLen = 128
+)
+
+// RequestIDMiddleware keeps the X-Request-ID sent by the client or generates
+// one, it is echoed in the response before calling the next handlers so the
+// error responses carry it too. Must be registered after otelfiber
+func RequestIDMiddleware(c *fiber.Ctx) error {
+	// Copied as it is stored in the context and outlives the request buffer
+	id := utils.CopyString(c.Get(RequestIDHeader))
+	if !validRequestID(id) {
+		id = utils.UUIDv4()
+	}
+	c.Set(RequestIDHeader, id)
+
+	ctx := c.UserContext()
+	trace.SpanFromContext(ctx).SetAttributes(requestIDKey.String(id))
+	c.SetUserContext(logger.WithRequestID(ctx, id))
+
+	return c.Next()
+}
+
+// validRequestID rejects ids that could be used to inject content in the
+// logs or the headers, only visible ascii is accepted
+func validRequestID(id string) bool {
+	return visibleASCII(id, maxRequestIDLen)
+}
+
+// visibleASCII is true for a non empty string of at most max visible ascii characters
+func visibleASCII(s string, max int) bool {
+	if s == "" || len(s) > max {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x21 || s[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package fbr
+
+import (
+	"net/http/httptest"
+	"prom/core/domain/logger"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Use(recover.New())
+	app.Use(RequestIDMiddleware)
+	app.Get("/ok", func(c *fiber.Ctx) error {
+		return c.SendString(logger.RequestID(c.UserContext()))
+	})
+	app.Get("/error", func(c *fiber.Ctx) error {
+		return fiber.ErrInternalServerError
+	})
+	app.Get("/panic", func(c *fiber.Ctx) error {
+		panic("boom")
+	})
+
+	cases := map[string]struct {
+		target   string
+		sent     string
+		status   int
+		expected string
+	}{
+		"kept":      {"/ok", "client-id-1", 200, "client-id-1"},
+		"generated": {"/ok", "", 200, ""},
+		"invalid":   {"/ok", "bad\tid", 200, ""},
+		"too long":  {"/ok", strings.Repeat("a", 129), 200, ""},
+		"error":     {"/error", "client-id-2", 500, "client-id-2"},
+		"panic":     {"/panic", "client-id-3", 500, "client-id-3"},
+		"not found": {"/missing", "client-id-4", 404, "client-id-4"},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tc.target, nil)
+			if tc.sent != "" {
+				req.Header.Set(RequestIDHeader, tc.sent)
+			}
+			resp, err := app.Test(req)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.status, resp.StatusCode)
+
+			id := resp.Header.Get(RequestIDHeader)
+			if tc.expected != "" {
+				assert.Equal(t, tc.expected, id)
+			} else {
+				assert.Len(t, id, 36)
+				assert.NotEqual(t, tc.sent, id)
+			}
+		})
+	}
+}
+
+func TestRequestIDOutlivesRequest(t *testing.T) {
+	app := fiber.New()
+	app.Use(RequestIDMiddleware)
+	var kept []string
+	app.Get("/ok", func(c *fiber.Ctx) error {
+		kept = append(kept, logger.RequestID(c.UserContext()))
+		return nil
+	})
+
+	for _, id := range []string{"client-id-1", "client-id-2"} {
+		req := httptest.NewRequest("GET", "/ok", nil)
+		req.Header.Set(RequestIDHeader, id)
+		_, err := app.Test(req)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"client-id-1", "client-id-2"}, kept)
+}
@@ -0,0 +1,108 @@
+package fbr
+
+import (
+	"net"
+	"prom/app/config"
+	"prom/core/domain/auth"
+	"prom/core/domain/tenancy"
+	"prom/core/usecases"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const maxTenantIDLen = 64
+
+// tenantResolver finds the tenant of the request in the principal claim, in a
+// header or in the subdomain. The requests without a tenant are let through,
+// the tenanted queries are the ones refusing them with a 403
+type tenantResolver struct {
+	sources []string
+	header  string
+	domain  string
+}
+
+func newTenantResolver(conf *config.AppConfig) *tenantResolver {
+	return &tenantResolver{
+		sources: conf.TenancySources,
+		header:  conf.TenancyHeader,
+		domain:  strings.ToLower(strings.TrimPrefix(conf.TenancyDomain, ".")),
+	}
+}
+
+// source returns the tenant sent by the client, copied as it outlives the request
+func (r *tenantResolver) source(c *fiber.Ctx, name string) string {
+	switch name {
+	case "header":
+		return utils.CopyString(c.Get(r.header))
+	case "subdomain":
+		if r.domain == "" {
+			return ""
+		}
+		host := strings.ToLower(utils.CopyString(c.Hostname()))
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if sub := strings.TrimSuffix(host, "."+r.domain); sub != host && !strings.Contains(sub, ".") {
+			return sub
+		}
+	}
+	return ""
+}
+
+// Middleware must be registered after the authenticator to read the claim. An
+// authenticated caller is bound to the tenant of its claim whatever the sources,
+// the subdomain may only agree with it and the header is ignored
+func (r *tenantResolver) Middleware(c *fiber.Ctx) error {
+	ctx := c.UserContext()
+	principal := auth.PrincipalFrom(ctx)
+
+	tenant := ""
+	if principal != nil {
+		tenant = principal.Tenant
+		if !validTenantID(tenant) {
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid tenant")
+		}
+	}
+	for _, name := range r.sources {
+		name = strings.TrimSpace(name)
+		if principal != nil && name == "header" {
+			continue
+		}
+		found := r.source(c, name)
+		switch {
+		case found == "":
+			continue
+		case !validTenantID(found):
+			return fiber.NewError(fiber.StatusBadRequest, "Invalid tenant")
+		case (principal != nil || tenant != "") && found != tenant:
+			// e.g. a subdomain naming another tenant than the one of the token
+			return fiber.NewError(fiber.StatusForbidden, "Conflicting tenants")
+		}
+		tenant = found
+	}
+	if tenant == "" {
+		return c.Next()
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(usecases.TenantIDKey.String(tenant))
+	c.SetUserContext(tenancy.WithTenant(ctx, tenant))
+
+	return c.Next()
+}
+
+// validTenantID accepts letters, digits, - and _ as in the subdomains
+func validTenantID(id string) bool {
+	if len(id) > maxTenantIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		ch := id[i]
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '-' || ch == '_') {
+			return false
+		}
+	}
+	return true
+}
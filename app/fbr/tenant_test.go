@@ -0,0 +1,145 @@
+package fbr
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"prom/app/config"
+	"prom/app/db"
+	"prom/core/domain/auth"
+	"prom/core/domain/tenancy"
+	"prom/core/usecases"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func TestTenantResolver(t *testing.T) {
+	resolver := newTenantResolver(&config.AppConfig{
+		TenancySources: []string{"claim", "header", "subdomain"},
+		TenancyHeader:  "X-Tenant-ID",
+		TenancyDomain:  "api.example.com",
+	})
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		if c.Get("X-Test-Principal") != "" {
+			c.SetUserContext(auth.WithPrincipal(c.UserContext(), &auth.Principal{Subject: "1", Tenant: c.Get("X-Test-Claim")}))
+		}
+		return c.Next()
+	})
+	app.Use(resolver.Middleware)
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendString(tenancy.Tenant(c.UserContext()))
+	})
+
+	tests := []struct {
+		host, header, claim string
+		authenticated       bool
+		status              int
+		tenant              string
+	}{
+		{"localhost", "", "", false, fiber.StatusOK, ""},
+		{"localhost", "acme", "", false, fiber.StatusOK, "acme"},
+		{"acme.api.example.com", "", "", false, fiber.StatusOK, "acme"},
+		{"acme.api.example.com", "globex", "", false, fiber.StatusForbidden, ""},
+		{"localhost", "../acme", "", false, fiber.StatusBadRequest, ""},
+		{"localhost", "", "acme", true, fiber.StatusOK, "acme"},
+		{"acme.api.example.com", "acme", "acme", true, fiber.StatusOK, "acme"},
+		{"globex.api.example.com", "", "acme", true, fiber.StatusForbidden, ""},
+		// The header never picks the tenant of an authenticated caller
+		{"localhost", "globex", "acme", true, fiber.StatusOK, "acme"},
+		{"localhost", "acme", "", true, fiber.StatusOK, ""},
+		{"acme.api.example.com", "", "", true, fiber.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "http://"+tt.host+"/", nil)
+		if tt.header != "" {
+			req.Header.Set("X-Tenant-ID", tt.header)
+		}
+		if tt.authenticated {
+			req.Header.Set("X-Test-Principal", "1")
+			req.Header.Set("X-Test-Claim", tt.claim)
+		}
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.status, resp.StatusCode, tt)
+		if tt.status == fiber.StatusOK {
+			body := make([]byte, 16)
+			n, _ := resp.Body.Read(body)
+			assert.Equal(t, tt.tenant, string(body[:n]))
+		}
+	}
+}
+
+func TestMissingTenant(t *testing.T) {
+	gormDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Discard})
+	assert.NoError(t, err)
+	repo, err := db.Setup(gormDB, true)
+	assert.NoError(t, err)
+	policy, err := auth.NewPolicy(false, nil, nil, "")
+	assert.NoError(t, err)
+	core, _ := observer.New(zapcore.DebugLevel)
+	log := observedLogger{zap.New(core)}
+
+	app := fiber.New()
+	app.Use(newTenantResolver(&config.AppConfig{TenancySources: []string{"claim"}}).Middleware)
+	app.Get("/v1/user", func(c *fiber.Ctx) error { return ListUsers(c, repo, policy, log) })
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/v1/user", nil))
+	assert.NoError(t, err)
+	assert.Equal(t, fiber.StatusForbidden, resp.StatusCode)
+}
+
+func TestTenantApiKeys(t *testing.T) {
+	gormDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormlogger.Discard})
+	assert.NoError(t, err)
+	repo, err := db.Setup(gormDB, true)
+	assert.NoError(t, err)
+	policy, err := auth.NewPolicy(true, nil, nil, "")
+	assert.NoError(t, err)
+	core, _ := observer.New(zapcore.DebugLevel)
+	log := observedLogger{zap.New(core)}
+	conf := &config.AppConfig{TenancySources: []string{"claim", "header"}, TenancyHeader: "X-Tenant-ID"}
+	authn, err := newAuthenticator(conf, repo, log)
+	assert.NoError(t, err)
+
+	app := fiber.New()
+	app.Use(authn.Middleware)
+	app.Use(newTenantResolver(conf).Middleware)
+	app.Get("/v1/user", func(c *fiber.Ctx) error { return ListUsers(c, repo, policy, log) })
+
+	admin := auth.WithPrincipal(context.Background(), &auth.Principal{Subject: "1", Scopes: []string{"admin"}})
+	_, acmeKey, err := usecases.CreateApiKey(repo, policy, admin, &db.ApiKey{Name: "acme", Scopes: []string{"user:read"}, TenantID: "acme"})
+	assert.NoError(t, err)
+	_, globalKey, err := usecases.CreateApiKey(repo, policy, admin, &db.ApiKey{Name: "global", Scopes: []string{"user:read"}})
+	assert.NoError(t, err)
+	assert.NoError(t, repo.WithContext(tenancy.WithTenant(context.Background(), "acme")).Create(&db.User{Name: "Alice Liddell"}).Error)
+	assert.NoError(t, repo.WithContext(tenancy.WithTenant(context.Background(), "globex")).Create(&db.User{Name: "Bob Marley"}).Error)
+
+	get := func(key string) *http.Response {
+		req := httptest.NewRequest("GET", "/v1/user", nil)
+		req.Header.Set(fiber.HeaderAuthorization, "ApiKey "+key)
+		// Ignored, the key picks the tenant
+		req.Header.Set("X-Tenant-ID", "globex")
+		resp, err := app.Test(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	resp := get(acmeKey)
+	assert.Equal(t, fiber.StatusOK, resp.StatusCode)
+	body, _ := io.ReadAll(resp.Body)
+	assert.Contains(t, string(body), "Alice Liddell")
+	assert.NotContains(t, string(body), "Bob Marley")
+
+	assert.Equal(t, fiber.StatusForbidden, get(globalKey).StatusCode)
+}
@@ -0,0 +1,177 @@
+package fbr
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"prom/app/config"
+	"sync"
+	"time"
+)
+
+func tlsEnabled(conf *config.AppConfig) bool {
+	return conf.TLSCertFile != "" && conf.TLSKeyFile != ""
+}
+
+func clientAuthType(mode string) (tls.ClientAuthType, error) {
+	switch mode {
+	case "require":
+		return tls.RequireAndVerifyClientCert, nil
+	case "optional":
+		return tls.VerifyClientCertIfGiven, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("Unknown tls client auth %q, expected require or optional", mode)
+	}
+}
+
+// certReloader serves the certificate and client CAs from disk and loads them
+// again when the files change, so rotated certificates don't need a restart
+type certReloader struct {
+	certFile   string
+	keyFile    string
+	caFile     string
+	clientAuth tls.ClientAuthType
+	interval   time.Duration
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+	checkedAt time.Time
+}
+
+func newCertReloader(certFile, keyFile, caFile string, clientAuth tls.ClientAuthType, interval time.Duration) (*certReloader, error) {
+	r := &certReloader{
+		certFile:   certFile,
+		keyFile:    keyFile,
+		caFile:     caFile,
+		clientAuth: clientAuth,
+		interval:   interval,
+	}
+
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.certFile, r.keyFile}
+	if r.caFile != "" {
+		files = append(files, r.caFile)
+	}
+	return files
+}
+
+func (r *certReloader) load() error {
+	modTimes := make(map[string]time.Time)
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return fmt.Errorf("Cannot stat tls file: %w", err)
+		}
+		modTimes[f] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("Cannot load tls certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("Cannot read tls client CA: %w", err)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("Cannot parse tls client CA %s", r.caFile)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.clientCAs = clientCAs
+	r.modTimes = modTimes
+	r.checkedAt = time.Now()
+	return nil
+}
+
+func (r *certReloader) changed() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for f, modTime := range r.modTimes {
+		info, err := os.Stat(f)
+		if err != nil {
+			// The file may be in the middle of a rotation, keep serving the old one
+			return false
+		}
+		if !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *certReloader) reloadIfChanged() {
+	r.mu.Lock()
+	due := time.Since(r.checkedAt) >= r.interval
+	if due {
+		r.checkedAt = time.Now()
+	}
+	r.mu.Unlock()
+
+	if !due || !r.changed() {
+		return
+	}
+
+	if err := r.load(); err != nil {
+		log.Printf("Keeping the previous tls certificate: %v", err)
+		return
+	}
+	log.Println("Reloaded tls certificate")
+}
+
+func (r *certReloader) GetConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.reloadIfChanged()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*r.cert},
+		ClientCAs:    r.clientCAs,
+		ClientAuth:   r.clientAuth,
+	}, nil
+}
+
+func newTLSConfig(conf *config.AppConfig) (*tls.Config, error) {
+	clientAuth := tls.NoClientCert
+	if conf.TLSClientCAFile != "" {
+		var err error
+		clientAuth, err = clientAuthType(conf.TLSClientAuth)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r, err := newCertReloader(
+		conf.TLSCertFile,
+		conf.TLSKeyFile,
+		conf.TLSClientCAFile,
+		clientAuth,
+		conf.TLSReloadInterval,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		GetConfigForClient: r.GetConfigForClient,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package fbr
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newTestCert signs a certificate for cn with parent, it is self signed when parent is nil
+func newTestCert(t *testing.T, cn string, serial int64, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	assert.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return &testCert{
+		cert: cert,
+		key:  key,
+		pem:  pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+	}
+}
+
+func (c *testCert) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	assert.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.pem, c.keyPEM(t))
+	assert.NoError(t, err)
+	return cert
+}
+
+// writeTestCert writes the certificate and key and moves their modification
+// time forward so the reloader notices the change on coarse file systems
+func writeTestCert(t *testing.T, certFile, keyFile string, c *testCert, modTime time.Time) {
+	assert.NoError(t, os.WriteFile(certFile, c.pem, 0o600))
+	assert.NoError(t, os.WriteFile(keyFile, c.keyPEM(t), 0o600))
+	assert.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	assert.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+func servedSerial(t *testing.T, r *certReloader) int64 {
+	conf, err := r.GetConfigForClient(nil)
+	assert.NoError(t, err)
+	leaf, err := x509.ParseCertificate(conf.Certificates[0].Certificate[0])
+	assert.NoError(t, err)
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	now := time.Now()
+
+	writeTestCert(t, certFile, keyFile, newTestCert(t, "localhost", 1, nil, x509.ExtKeyUsageServerAuth), now)
+	r, err := newCertReloader(certFile, keyFile, "", tls.NoClientCert, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), servedSerial(t, r))
+
+	t.Run("reloads a rotated certificate", func(t *testing.T) {
+		writeTestCert(t, certFile, keyFile, newTestCert(t, "localhost", 2, nil, x509.ExtKeyUsageServerAuth), now.Add(time.Minute))
+		assert.Equal(t, int64(2), servedSerial(t, r))
+	})
+
+	t.Run("keeps the previous certificate when the new one is invalid", func(t *testing.T) {
+		modTime := now.Add(2 * time.Minute)
+		assert.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0o600))
+		assert.NoError(t, os.Chtimes(certFile, modTime, modTime))
+		assert.Equal(t, int64(2), servedSerial(t, r))
+	})
+
+	t.Run("waits for the reload interval", func(t *testing.T) {
+		r.interval = time.Hour
+		r.checkedAt = time.Now()
+		writeTestCert(t, certFile, keyFile, newTestCert(t, "localhost", 3, nil, x509.ExtKeyUsageServerAuth), now.Add(3*time.Minute))
+		assert.Equal(t, int64(2), servedSerial(t, r))
+	})
+}
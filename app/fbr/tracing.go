@@ -0,0 +1,43 @@
+package fbr
+
+import (
+	"fmt"
+	"net/http"
+	appotel "prom/app/otel"
+	"prom/core/usecases"
+
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+)
+
+// traced runs the handler in a span with the given name, the user context of
+// the handler is the one of the span. The status of the span is set from the
+// response, a 5xx or a returned error is an error
+func traced(name string, handler fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		parent := c.UserContext()
+		ctx, span := appotel.GetTracerInstance().Start(parent, name)
+		defer span.End()
+		c.SetUserContext(ctx)
+		defer c.SetUserContext(parent)
+
+		if uid, err := c.ParamsInt("id"); err == nil {
+			span.SetAttributes(usecases.UserIDKey.Int(uid))
+		}
+
+		err := handler(c)
+
+		status := responseStatus(c, err)
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+
+		switch {
+		case err != nil:
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		case status >= http.StatusInternalServerError:
+			span.SetStatus(codes.Error, fmt.Sprintf("Responded with status %d", status))
+		}
+		return err
+	}
+}
@@ -15,7 +15,7 @@ type ErrorResponse struct {
     Value       string
 }
 
-func ValidateStruct[T db.User](s T) []*ErrorResponse {
+func ValidateStruct[T db.User | CreateApiKeyRequest](s T) []*ErrorResponse {
 	var errors []*ErrorResponse
 	err := validate.Struct(s)
 	if err != nil {
@@ -0,0 +1,15 @@
+package fbr
+
+import (
+	"net/http"
+	appotel "prom/app/otel"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Version serves the build metadata, the same reported in the otel resource
+func Version(info appotel.BuildInfo) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.Status(http.StatusOK).JSON(info)
+	}
+}
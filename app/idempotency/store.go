@@ -0,0 +1,174 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"prom/app/db"
+	"prom/core/domain/repository"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// pollInterval is how often a duplicate checks whether the first request completed
+	pollInterval = 100 * time.Millisecond
+	// cleanupInterval is how often the expired keys are removed
+	cleanupInterval = time.Minute
+)
+
+var (
+	// ErrKeyReused is returned when the key was used for a different request
+	ErrKeyReused = errors.New("The idempotency key was used for a different request")
+	// ErrInFlight is returned when the first request with the key is still running
+	ErrInFlight = errors.New("A request with the same idempotency key is in progress")
+	// ErrLockLost is returned when the lock timed out and was taken over by a retry
+	ErrLockLost = errors.New("The idempotency key was taken over by another request")
+)
+
+// Response is the stored response replayed for the repeated keys
+type Response struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// Store keeps the requests made with an idempotency key in mysql. The first
+// request locks the key until it completes or the lock times out, e.g. when
+// the replica running it died
+type Store struct {
+	conn        repository.Connection
+	ttl         time.Duration
+	lockTimeout time.Duration
+	waitTimeout time.Duration
+	cleaned     atomic.Int64
+}
+
+func NewStore(conn repository.Connection, ttl, lockTimeout, waitTimeout time.Duration) *Store {
+	s := &Store{conn: conn, ttl: ttl, lockTimeout: lockTimeout, waitTimeout: waitTimeout}
+	s.cleaned.Store(time.Now().UnixNano())
+	return s
+}
+
+// Begin locks the key for the request with the fingerprint and returns the
+// token of the lock, or the stored response when the key was already completed.
+// A duplicate in flight is waited for up to the wait timeout
+func (s *Store) Begin(ctx context.Context, key, fingerprint string) (*Response, string, error) {
+	s.cleanup(ctx)
+
+	deadline := time.Now().Add(s.waitTimeout)
+	for {
+		resp, token, err := s.begin(ctx, key, fingerprint)
+		if !errors.Is(err, ErrInFlight) || time.Now().After(deadline) {
+			return resp, token, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, "", ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func (s *Store) begin(ctx context.Context, key, fingerprint string) (*Response, string, error) {
+	now := time.Now()
+	conn := s.conn.WithContext(ctx)
+
+	token, err := newToken()
+	if err != nil {
+		return nil, "", err
+	}
+	// Only one of the concurrent requests inserts the key
+	tx := conn.Clauses(clause.OnConflict{DoNothing: true}).Create(&db.IdempotencyKey{
+		Key:         key,
+		Fingerprint: fingerprint,
+		Token:       token,
+		LockedUntil: now.Add(s.lockTimeout),
+		ExpiresAt:   now.Add(s.ttl),
+	})
+	if tx.Error != nil {
+		return nil, "", fmt.Errorf("Cannot lock the idempotency key: %w", tx.Error)
+	}
+	if tx.RowsAffected == 1 {
+		return nil, token, nil
+	}
+
+	record := &db.IdempotencyKey{}
+	if err := conn.Where("`key` = ?", key).First(record).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Released meanwhile
+			return s.begin(ctx, key, fingerprint)
+		}
+		return nil, "", fmt.Errorf("Cannot get the idempotency key: %w", err)
+	}
+
+	abandoned := record.Status == 0 && now.After(record.LockedUntil)
+	if now.After(record.ExpiresAt) || abandoned {
+		// Taken over only by the request that deletes the row it read
+		tx := conn.Where("`key` = ? AND token = ?", key, record.Token).Delete(&db.IdempotencyKey{})
+		if tx.Error != nil {
+			return nil, "", fmt.Errorf("Cannot delete the idempotency key: %w", tx.Error)
+		}
+		if tx.RowsAffected == 0 {
+			return nil, "", ErrInFlight
+		}
+		return s.begin(ctx, key, fingerprint)
+	}
+
+	if record.Fingerprint != fingerprint {
+		return nil, "", ErrKeyReused
+	}
+	if record.Status == 0 {
+		return nil, "", ErrInFlight
+	}
+	return &Response{Status: record.Status, ContentType: record.ContentType, Body: record.Body}, "", nil
+}
+
+// Complete stores the response replayed for the key until it expires, only
+// while the request still owns the lock
+func (s *Store) Complete(ctx context.Context, key, token string, resp Response) error {
+	tx := s.conn.WithContext(ctx).Model(&db.IdempotencyKey{}).Where("`key` = ? AND token = ? AND status = 0", key, token).Updates(map[string]interface{}{
+		"status":       resp.Status,
+		"content_type": resp.ContentType,
+		"body":         resp.Body,
+	})
+	if tx.Error != nil {
+		return fmt.Errorf("Cannot store the idempotent response: %w", tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// Release forgets the key so the request can be retried, e.g. after a failure.
+// The key of another owner is left alone
+func (s *Store) Release(ctx context.Context, key, token string) error {
+	if err := s.conn.WithContext(ctx).Where("`key` = ? AND token = ?", key, token).Delete(&db.IdempotencyKey{}).Error; err != nil {
+		return fmt.Errorf("Cannot release the idempotency key: %w", err)
+	}
+	return nil
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Cannot generate the idempotency lock token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func (s *Store) cleanup(ctx context.Context) {
+	now := time.Now()
+	last := s.cleaned.Load()
+	if now.UnixNano()-last < int64(cleanupInterval) || !s.cleaned.CompareAndSwap(last, now.UnixNano()) {
+		return
+	}
+	// Best effort, the expired keys are also ignored when read
+	s.conn.WithContext(ctx).Where("expires_at < ?", now).Delete(&db.IdempotencyKey{})
+}
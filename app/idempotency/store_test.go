@@ -0,0 +1,93 @@
+package idempotency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"prom/app/db"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTestConn(t *testing.T) *gorm.DB {
+	conn, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	assert.NoError(t, err)
+	assert.NoError(t, conn.AutoMigrate(&db.IdempotencyKey{}))
+	sqlDB, err := conn.DB()
+	assert.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	return conn
+}
+
+func TestStore(t *testing.T) {
+	s := NewStore(newTestConn(t), time.Hour, time.Minute, 50*time.Millisecond)
+	ctx := context.Background()
+
+	resp, token, err := s.Begin(ctx, "key", "request")
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+	assert.NotEmpty(t, token)
+
+	_, _, err = s.Begin(ctx, "key", "request")
+	assert.ErrorIs(t, err, ErrInFlight)
+	_, _, err = s.Begin(ctx, "key", "another request")
+	assert.ErrorIs(t, err, ErrKeyReused)
+
+	assert.NoError(t, s.Complete(ctx, "key", token, Response{Status: 200, ContentType: "application/json", Body: []byte(`{"id":1}`)}))
+	resp, _, err = s.Begin(ctx, "key", "request")
+	assert.NoError(t, err)
+	assert.Equal(t, &Response{Status: 200, ContentType: "application/json", Body: []byte(`{"id":1}`)}, resp)
+
+	assert.NoError(t, s.Release(ctx, "key", token))
+	resp, _, err = s.Begin(ctx, "key", "another request")
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+}
+
+func TestStoreWaitsForInFlight(t *testing.T) {
+	s := NewStore(newTestConn(t), time.Hour, time.Minute, 2*time.Second)
+	ctx := context.Background()
+
+	_, token, err := s.Begin(ctx, "key", "request")
+	assert.NoError(t, err)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		s.Complete(ctx, "key", token, Response{Status: 201, Body: []byte("created")})
+	}()
+
+	resp, _, err := s.Begin(ctx, "key", "request")
+	assert.NoError(t, err)
+	assert.Equal(t, 201, resp.Status)
+}
+
+func TestStoreTakesOverAbandonedAndExpiredKeys(t *testing.T) {
+	ctx := context.Background()
+
+	abandoned := NewStore(newTestConn(t), time.Hour, -time.Second, 0)
+	_, stale, err := abandoned.Begin(ctx, "key", "request")
+	assert.NoError(t, err)
+	resp, token, err := abandoned.Begin(ctx, "key", "request")
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+	assert.NotEqual(t, stale, token)
+
+	// The request whose lock was taken over can neither store nor release the key
+	assert.ErrorIs(t, abandoned.Complete(ctx, "key", stale, Response{Status: 200, Body: []byte("stale")}), ErrLockLost)
+	assert.NoError(t, abandoned.Release(ctx, "key", stale))
+	assert.NoError(t, abandoned.Complete(ctx, "key", token, Response{Status: 201, Body: []byte("created")}))
+	resp, _, err = abandoned.Begin(ctx, "key", "request")
+	assert.NoError(t, err)
+	assert.Equal(t, &Response{Status: 201, Body: []byte("created")}, resp)
+
+	expired := NewStore(newTestConn(t), -time.Second, time.Minute, 0)
+	_, token, err = expired.Begin(ctx, "key", "request")
+	assert.NoError(t, err)
+	assert.NoError(t, expired.Complete(ctx, "key", token, Response{Status: 200}))
+	resp, _, err = expired.Begin(ctx, "key", "another request")
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+}
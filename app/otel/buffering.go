@@ -0,0 +1,75 @@
+package otel
+
+import (
+	"context"
+	"sync/atomic"
+
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// boundedSpanProcessor keeps at most max spans waiting to be exported, the
+// spans ended past that bound while the collector is slow or unreachable
+// are dropped and counted instead of being silently discarded by the batcher
+type boundedSpanProcessor struct {
+	sdktrace.SpanProcessor
+	pending *atomic.Int64
+	max     int64
+}
+
+// newBoundedSpanProcessor wraps the batch span processor, its queue must be
+// at least max so that it never drops on its own
+func newBoundedSpanProcessor(exporter sdktrace.SpanExporter, max int, opts ...sdktrace.BatchSpanProcessorOption) sdktrace.SpanProcessor {
+	pending := &atomic.Int64{}
+	exporter = &trackedSpanExporter{SpanExporter: exporter, pending: pending}
+	opts = append(opts, sdktrace.WithMaxQueueSize(max))
+	return &boundedSpanProcessor{
+		SpanProcessor: sdktrace.NewBatchSpanProcessor(exporter, opts...),
+		pending:       pending,
+		max:           int64(max),
+	}
+}
+
+func (p *boundedSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	// Not sampled spans are ignored by the batcher
+	if !s.SpanContext().IsSampled() {
+		return
+	}
+	if p.pending.Add(1) > p.max {
+		p.pending.Add(-1)
+		RecordDropped(context.Background(), "traces", "queue_full", 1)
+		return
+	}
+	p.SpanProcessor.OnEnd(s)
+}
+
+// trackedSpanExporter releases the exported spans from the bound and reports
+// the outcome of every export
+type trackedSpanExporter struct {
+	sdktrace.SpanExporter
+	pending *atomic.Int64
+}
+
+func (e *trackedSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	e.pending.Add(-int64(len(spans)))
+	RecordExport(ctx, "traces", len(spans), err)
+	return err
+}
+
+// trackedMetricExporter reports the outcome of every export, the metrics are
+// cumulative so the next successful export catches up with the failed ones
+type trackedMetricExporter struct {
+	sdkmetric.Exporter
+}
+
+func (e *trackedMetricExporter) Export(ctx context.Context, rm metricdata.ResourceMetrics) error {
+	err := e.Exporter.Export(ctx, rm)
+	count := 0
+	for _, sm := range rm.ScopeMetrics {
+		count += len(sm.Metrics)
+	}
+	RecordExport(ctx, "metrics", count, err)
+	return err
+}
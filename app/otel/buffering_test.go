@@ -0,0 +1,76 @@
+package otel
+
+import (
+	"context"
+	"errors"
+	"prom/app/config"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// blockingExporter holds the exports until released, like an unreachable collector
+type blockingExporter struct {
+	release  chan struct{}
+	exported atomic.Int64
+}
+
+func (e *blockingExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	<-e.release
+	e.exported.Add(int64(len(spans)))
+	return nil
+}
+
+func (e *blockingExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+func TestBoundedSpanProcessorDropsPastMax(t *testing.T) {
+	exporter := &blockingExporter{release: make(chan struct{})}
+	bsp := newBoundedSpanProcessor(exporter, 2, sdktrace.WithMaxExportBatchSize(1), sdktrace.WithBatchTimeout(time.Millisecond))
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(bsp))
+
+	for i := 0; i < 5; i++ {
+		_, span := tp.Tracer("test").Start(context.Background(), "span")
+		span.End()
+	}
+	assert.Equal(t, int64(2), bsp.(*boundedSpanProcessor).pending.Load())
+
+	close(exporter.release)
+	assert.NoError(t, tp.Shutdown(context.Background()))
+	assert.Equal(t, int64(2), exporter.exported.Load())
+	assert.Equal(t, int64(0), bsp.(*boundedSpanProcessor).pending.Load())
+}
+
+func TestRecordExportDegraded(t *testing.T) {
+	RecordExport(context.Background(), "logs", 3, errors.New("connection refused"))
+	assert.Equal(t, []string{"logs: connection refused"}, Degraded())
+
+	RecordExport(context.Background(), "logs", 3, nil)
+	assert.Empty(t, Degraded())
+}
+
+func TestInitTracerWithoutCollector(t *testing.T) {
+	conf := &config.AppConfig{
+		ServiceName:           "ms-baselines-golang",
+		OTELCollectorURL:      "127.0.0.1:1",
+		EnableOtelTraces:      true,
+		TracesExporter:        "otlp",
+		TracesExportQueueSize: 8,
+		TracesExportBatchSize: 4,
+		TracesSampler:         "always_on",
+		Propagators:           []string{"tracecontext"},
+	}
+
+	start := time.Now()
+	shutdown, err := InitTracer(context.Background(), conf)
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	shutdown(ctx)
+}
@@ -0,0 +1,223 @@
+package otel
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"prom/app/config"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// exporterResources are closed once the provider using them is shut down
+type exporterResources struct {
+	conn   *grpc.ClientConn
+	signal string
+	files  []io.Closer
+}
+
+func (r *exporterResources) close() error {
+	for _, f := range r.files {
+		f.Close()
+	}
+	if r.conn != nil {
+		unwatchConn(r.signal)
+		return r.conn.Close()
+	}
+	return nil
+}
+
+// ExporterNames trims the exporters listed for a signal, a repeated exporter
+// is rejected as it would be set up twice
+func ExporterNames(signal string, names []string) ([]string, error) {
+	seen := make(map[string]bool, len(names))
+	trimmed := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("Duplicate %s exporter %q", signal, name)
+		}
+		seen[name] = true
+		trimmed = append(trimmed, name)
+	}
+	return trimmed, nil
+}
+
+// newSpanExporter returns a nil exporter for none, the spans are still created
+// so the trace ids keep being propagated and logged
+func newSpanExporter(ctx context.Context, conf *config.AppConfig, res *exporterResources) (sdktrace.SpanExporter, error) {
+	switch name := conf.TracesExporterName(); name {
+	case "otlp":
+		conn, err := dialCollector(ctx, conf)
+		if err != nil {
+			return nil, err
+		}
+		res.conn, res.signal = conn, "traces"
+		watchConn("traces", conn)
+		return otlptracegrpc.New(ctx, otlptracegrpc.WithGRPCConn(conn))
+	case "otlphttp":
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(conf.OTLPHTTPEndpoint),
+			otlptracehttp.WithHeaders(conf.OTLPHTTPHeaders),
+		}
+		if conf.OTLPHTTPCompression == "gzip" {
+			opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+		}
+		if conf.OTLPHTTPInsecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		} else {
+			tlsConf, err := OTLPHTTPTLSConfig(conf)
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsConf))
+		}
+		return otlptracehttp.New(ctx, opts...)
+	case "file":
+		w, err := NewFileWriter(conf, "traces")
+		if err != nil {
+			return nil, err
+		}
+		res.files = append(res.files, w)
+		return stdouttrace.New(stdouttrace.WithWriter(w))
+	case "stdout":
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("Unknown traces exporter %q", name)
+	}
+}
+
+// newMetricReaders returns a reader per exporter in METRICS_EXPORTERS
+func newMetricReaders(ctx context.Context, conf *config.AppConfig, res *exporterResources) ([]metric.Option, error) {
+	names, err := ExporterNames("metrics", conf.MetricsExporters)
+	if err != nil {
+		return nil, err
+	}
+
+	var readers []metric.Option
+	for _, name := range names {
+		var exp metric.Exporter
+		var err error
+
+		switch name {
+		case "otlp":
+			var conn *grpc.ClientConn
+			conn, err = dialCollector(ctx, conf)
+			if err != nil {
+				return nil, err
+			}
+			res.conn, res.signal = conn, "metrics"
+			watchConn("metrics", conn)
+			exp, err = otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithGRPCConn(conn))
+		case "otlphttp":
+			opts := []otlpmetrichttp.Option{
+				otlpmetrichttp.WithEndpoint(conf.OTLPHTTPEndpoint),
+				otlpmetrichttp.WithHeaders(conf.OTLPHTTPHeaders),
+			}
+			if conf.OTLPHTTPCompression == "gzip" {
+				opts = append(opts, otlpmetrichttp.WithCompression(otlpmetrichttp.GzipCompression))
+			}
+			if conf.OTLPHTTPInsecure {
+				opts = append(opts, otlpmetrichttp.WithInsecure())
+			} else {
+				var tlsConf *tls.Config
+				if tlsConf, err = OTLPHTTPTLSConfig(conf); err != nil {
+					return nil, err
+				}
+				opts = append(opts, otlpmetrichttp.WithTLSClientConfig(tlsConf))
+			}
+			exp, err = otlpmetrichttp.New(ctx, opts...)
+		case "prometheus":
+			// Registered in the default prometheus registry, scraped from /metrics in the admin port
+			reader, err := prometheus.New()
+			if err != nil {
+				return nil, fmt.Errorf("Error configuring prometheus exporter: %w", err)
+			}
+			readers = append(readers, metric.WithReader(reader))
+			continue
+		case "file":
+			var w io.WriteCloser
+			if w, err = NewFileWriter(conf, "metrics"); err != nil {
+				return nil, err
+			}
+			res.files = append(res.files, w)
+			exp, err = stdoutmetric.New(stdoutmetric.WithEncoder(json.NewEncoder(w)))
+		case "stdout":
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			exp, err = stdoutmetric.New(stdoutmetric.WithEncoder(enc))
+		case "none":
+			continue
+		default:
+			return nil, fmt.Errorf("Unknown metrics exporter %q", name)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Error configuring %s metrics exporter: %w", name, err)
+		}
+		readers = append(readers, metric.WithReader(metric.NewPeriodicReader(&trackedMetricExporter{exp})))
+	}
+	return readers, nil
+}
+
+// OTLPHTTPTLSConfig verifies the collector with OTLP_HTTP_CA_FILE when set and
+// presents the client certificate to collectors requiring mutual TLS
+func OTLPHTTPTLSConfig(conf *config.AppConfig) (*tls.Config, error) {
+	tlsConf := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if conf.OTLPHTTPCAFile != "" {
+		pem, err := os.ReadFile(conf.OTLPHTTPCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read otlp http CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("No certificates found in %s", conf.OTLPHTTPCAFile)
+		}
+		tlsConf.RootCAs = pool
+	}
+
+	if conf.OTLPHTTPCertFile != "" || conf.OTLPHTTPKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(conf.OTLPHTTPCertFile, conf.OTLPHTTPKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot load otlp http client certificate: %w", err)
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConf, nil
+}
+
+// NewFileWriter returns the <signal>.jsonl file in FILE_EXPORTER_DIR, it is
+// rotated once it reaches the max size keeping the configured backups
+func NewFileWriter(conf *config.AppConfig, signal string) (io.WriteCloser, error) {
+	if err := os.MkdirAll(conf.FileExporterDir, 0o755); err != nil {
+		return nil, fmt.Errorf("Cannot create file exporter dir: %w", err)
+	}
+	return &lumberjack.Logger{
+		Filename:   filepath.Join(conf.FileExporterDir, signal+".jsonl"),
+		MaxSize:    conf.FileExporterMaxSizeMB,
+		MaxBackups: conf.FileExporterMaxBackups,
+	}, nil
+}
@@ -0,0 +1,78 @@
+package otel
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"prom/app/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestFileSpanExporter(t *testing.T) {
+	conf := &config.AppConfig{
+		EnableOtelTraces:       true,
+		TracesExporter:         "file",
+		FileExporterDir:        t.TempDir(),
+		FileExporterMaxSizeMB:  1,
+		FileExporterMaxBackups: 1,
+	}
+	res := &exporterResources{}
+	exporter, err := newSpanExporter(context.Background(), conf, res)
+	assert.NoError(t, err)
+
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	for _, name := range []string{"GetUserHandler", "getUserUC"} {
+		_, span := tp.Tracer("test").Start(context.Background(), name)
+		span.End()
+	}
+	assert.NoError(t, tp.Shutdown(context.Background()))
+	assert.NoError(t, res.close())
+
+	f, err := os.Open(filepath.Join(conf.FileExporterDir, "traces.jsonl"))
+	assert.NoError(t, err)
+	defer f.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var span struct{ Name string }
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &span))
+		names = append(names, span.Name)
+	}
+	assert.Equal(t, []string{"GetUserHandler", "getUserUC"}, names)
+}
+
+func TestSpanExporterSelection(t *testing.T) {
+	exporter, err := newSpanExporter(context.Background(), &config.AppConfig{EnableOtelTraces: true, TracesExporter: "none"}, &exporterResources{})
+	assert.NoError(t, err)
+	assert.Nil(t, exporter)
+
+	_, err = newSpanExporter(context.Background(), &config.AppConfig{EnableOtelTraces: true, TracesExporter: "zipkin"}, &exporterResources{})
+	assert.Error(t, err)
+
+	_, err = newMetricReaders(context.Background(), &config.AppConfig{MetricsExporters: []string{"statsd"}}, &exporterResources{})
+	assert.Error(t, err)
+
+	_, err = newMetricReaders(context.Background(), &config.AppConfig{MetricsExporters: []string{"otlp", " otlp"}}, &exporterResources{})
+	assert.ErrorContains(t, err, `Duplicate metrics exporter "otlp"`)
+}
+
+func TestExporterNames(t *testing.T) {
+	names, err := ExporterNames("log", []string{"stdout", " otlp ", ""})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"stdout", "otlp"}, names)
+
+	_, err = ExporterNames("log", []string{"otlp", "otlp"})
+	assert.Error(t, err)
+}
+
+func TestTracesExporterName(t *testing.T) {
+	assert.Equal(t, "stdout", (&config.AppConfig{EnableOtelTraces: false, TracesExporter: "otlp"}).TracesExporterName())
+	assert.Equal(t, "otlphttp", (&config.AppConfig{EnableOtelTraces: false, TracesExporter: "otlphttp"}).TracesExporterName())
+	assert.Equal(t, "otlp", (&config.AppConfig{EnableOtelTraces: true, TracesExporter: "otlp"}).TracesExporterName())
+}
@@ -0,0 +1,141 @@
+package otel
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/syncint64"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// exportHealth tracks whether the telemetry reaches the collector, the service
+// keeps serving without it but reports itself as degraded
+type exportHealth struct {
+	mu       sync.Mutex
+	failures map[string]error
+	conns    map[string]*grpc.ClientConn
+
+	droppedOnce sync.Once
+	dropped     syncint64.Counter
+}
+
+var health = &exportHealth{
+	failures: map[string]error{},
+	conns:    map[string]*grpc.ClientConn{},
+}
+
+// watchConn reports the signal as degraded while the connection is failing
+func watchConn(signal string, conn *grpc.ClientConn) {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	health.conns[signal] = conn
+}
+
+func unwatchConn(signal string) {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+	delete(health.conns, signal)
+}
+
+// RecordExport keeps the outcome of the last export of the signal, the failed
+// batches are counted as dropped as they are not retried anymore
+func RecordExport(ctx context.Context, signal string, count int, err error) {
+	health.mu.Lock()
+	_, wasFailing := health.failures[signal]
+	if err != nil {
+		health.failures[signal] = err
+	} else {
+		delete(health.failures, signal)
+	}
+	health.mu.Unlock()
+
+	switch {
+	case err != nil && !wasFailing:
+		log.Printf("Cannot export %s to the collector, running degraded: %v", signal, err)
+	case err == nil && wasFailing:
+		log.Printf("Exporting %s to the collector again", signal)
+	}
+
+	if err != nil {
+		RecordDropped(ctx, signal, "export_failed", count)
+	}
+}
+
+// RecordDropped counts the telemetry discarded before reaching the collector
+func RecordDropped(ctx context.Context, signal, reason string, count int) {
+	if count <= 0 {
+		return
+	}
+	health.droppedOnce.Do(func() {
+		dropped, err := GetMeterInstance().SyncInt64().Counter(
+			"otel.exporter.dropped",
+			instrument.WithDescription("Number of spans, metrics and log records dropped before reaching the collector"),
+		)
+		if err != nil {
+			log.Printf("Cannot create the dropped telemetry counter: %v", err)
+			return
+		}
+		health.dropped = dropped
+	})
+	if health.dropped == nil {
+		return
+	}
+	health.dropped.Add(ctx, int64(count),
+		attribute.String("signal", signal),
+		attribute.String("reason", reason),
+	)
+}
+
+// Degraded returns the reasons why the telemetry is not reaching the
+// collector, it is empty when every signal is exported
+func Degraded() []string {
+	health.mu.Lock()
+	defer health.mu.Unlock()
+
+	var reasons []string
+	for signal, err := range health.failures {
+		reasons = append(reasons, fmt.Sprintf("%s: %v", signal, err))
+	}
+	for signal, conn := range health.conns {
+		if _, failing := health.failures[signal]; failing {
+			continue
+		}
+		if conn.GetState() == connectivity.TransientFailure {
+			reasons = append(reasons, fmt.Sprintf("%s: collector unreachable", signal))
+		}
+	}
+	sort.Strings(reasons)
+	return reasons
+}
+
+// DegradedReason joins the reasons of Degraded
+func DegradedReason() string {
+	return strings.Join(Degraded(), "; ")
+}
+
+// registerDegradedGauge exports 1 while the telemetry is degraded so it can be
+// alerted on from the prometheus endpoint when the collector is down
+func registerDegradedGauge(meter metric.Meter) error {
+	degraded, err := meter.AsyncInt64().Gauge(
+		"otel.exporter.degraded",
+		instrument.WithDescription("1 while the telemetry cannot be exported to the collector"),
+	)
+	if err != nil {
+		return err
+	}
+	return meter.RegisterCallback([]instrument.Asynchronous{degraded}, func(ctx context.Context) {
+		value := int64(0)
+		if len(Degraded()) > 0 {
+			value = 1
+		}
+		degraded.Observe(ctx, value)
+	})
+}
@@ -0,0 +1,26 @@
+package otel
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+)
+
+var meterSingleLock = &sync.Mutex{}
+
+var meterInstance metric.Meter
+
+// GetMeterInstance returns the meter of this module, the instruments created
+// before InitMetricsProvider are delegated to the provider once it is set
+func GetMeterInstance() metric.Meter {
+	if meterInstance == nil {
+		meterSingleLock.Lock()
+
+		defer meterSingleLock.Unlock()
+		if meterInstance == nil {
+			meterInstance = global.Meter(InstrumentationName)
+		}
+	}
+	return meterInstance
+}
@@ -0,0 +1,94 @@
+package oteltest
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// FindSpan returns the first span with the given name or nil
+func FindSpan(spans []*tracepb.Span, name string) *tracepb.Span {
+	for _, s := range spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// AssertSpanChain checks that every named span is the child of the previous
+// one in the same trace, e.g. GetUserHandler -> getUserUC -> gorm.Query
+func AssertSpanChain(t testing.TB, spans []*tracepb.Span, names ...string) []*tracepb.Span {
+	t.Helper()
+
+	chain := make([]*tracepb.Span, 0, len(names))
+	var parent *tracepb.Span
+	for _, name := range names {
+		var found *tracepb.Span
+		for _, s := range spans {
+			if s.Name != name {
+				continue
+			}
+			if parent == nil || (bytes.Equal(s.ParentSpanId, parent.SpanId) && bytes.Equal(s.TraceId, parent.TraceId)) {
+				found = s
+				break
+			}
+		}
+		if found == nil {
+			if parent == nil {
+				t.Fatalf("Span %s was not exported, got %v", name, spanNames(spans))
+			}
+			t.Fatalf("Span %s is not a child of %s, got %v", name, parent.Name, spanNames(spans))
+		}
+		chain = append(chain, found)
+		parent = found
+	}
+	return chain
+}
+
+// AssertSpanAttribute checks the attribute of the span, the value is
+// compared with its string representation
+func AssertSpanAttribute(t testing.TB, span *tracepb.Span, key string, expected interface{}) {
+	t.Helper()
+
+	value, ok := Attribute(span.Attributes, key)
+	if !ok {
+		t.Fatalf("Span %s has no attribute %s", span.Name, key)
+	}
+	if fmt.Sprint(expected) != value {
+		t.Fatalf("Span %s attribute %s is %q, expected %q", span.Name, key, value, fmt.Sprint(expected))
+	}
+}
+
+// Attribute returns the string representation of the attribute value
+func Attribute(attrs []*commonpb.KeyValue, key string) (string, bool) {
+	for _, kv := range attrs {
+		if kv.Key != key {
+			continue
+		}
+		switch v := kv.Value.Value.(type) {
+		case *commonpb.AnyValue_StringValue:
+			return v.StringValue, true
+		case *commonpb.AnyValue_IntValue:
+			return fmt.Sprint(v.IntValue), true
+		case *commonpb.AnyValue_BoolValue:
+			return fmt.Sprint(v.BoolValue), true
+		case *commonpb.AnyValue_DoubleValue:
+			return fmt.Sprint(v.DoubleValue), true
+		default:
+			return kv.Value.String(), true
+		}
+	}
+	return "", false
+}
+
+func spanNames(spans []*tracepb.Span) []string {
+	names := make([]string, 0, len(spans))
+	for _, s := range spans {
+		names = append(names, s.Name)
+	}
+	return names
+}
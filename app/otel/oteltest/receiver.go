@@ -0,0 +1,189 @@
+// Package oteltest provides an in-process OTLP receiver so the tests can
+// assert on the exported telemetry without running the collector
+package oteltest
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	colmetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/grpc"
+)
+
+// Receiver is an OTLP gRPC receiver keeping everything it receives in memory
+type Receiver struct {
+	server *grpc.Server
+	addr   string
+
+	mu      sync.Mutex
+	spans   []*tracepb.Span
+	metrics []*metricspb.Metric
+	logs    []*logspb.LogRecord
+}
+
+// NewReceiver starts a receiver on a random port of the loopback interface
+// and points OTEL_COLLECTOR_URL at it, it is stopped when the test ends
+func NewReceiver(t testing.TB) *Receiver {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Cannot listen for the otlp receiver: %v", err)
+	}
+
+	r := &Receiver{
+		server: grpc.NewServer(),
+		addr:   ln.Addr().String(),
+	}
+	coltracepb.RegisterTraceServiceServer(r.server, &traceService{r: r})
+	colmetricspb.RegisterMetricsServiceServer(r.server, &metricsService{r: r})
+	collogspb.RegisterLogsServiceServer(r.server, &logsService{r: r})
+
+	go r.server.Serve(ln)
+	t.Cleanup(r.server.Stop)
+	t.Setenv("OTEL_COLLECTOR_URL", r.addr)
+
+	return r
+}
+
+// Addr is the host:port the receiver listens on
+func (r *Receiver) Addr() string {
+	return r.addr
+}
+
+func (r *Receiver) Spans() []*tracepb.Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*tracepb.Span(nil), r.spans...)
+}
+
+func (r *Receiver) Metrics() []*metricspb.Metric {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*metricspb.Metric(nil), r.metrics...)
+}
+
+func (r *Receiver) Logs() []*logspb.LogRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*logspb.LogRecord(nil), r.logs...)
+}
+
+// Reset forgets everything received so far
+func (r *Receiver) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans, r.metrics, r.logs = nil, nil, nil
+}
+
+// WaitForSpan returns the first span with the given name, it fails the test
+// when none is received before the timeout
+func (r *Receiver) WaitForSpan(t testing.TB, name string, timeout time.Duration) *tracepb.Span {
+	t.Helper()
+	var found *tracepb.Span
+	waitFor(t, timeout, "span "+name, func() bool {
+		found = FindSpan(r.Spans(), name)
+		return found != nil
+	})
+	return found
+}
+
+// WaitForMetric returns the last data received for the given metric name
+func (r *Receiver) WaitForMetric(t testing.TB, name string, timeout time.Duration) *metricspb.Metric {
+	t.Helper()
+	var found *metricspb.Metric
+	waitFor(t, timeout, "metric "+name, func() bool {
+		metrics := r.Metrics()
+		for i := len(metrics) - 1; i >= 0; i-- {
+			if metrics[i].Name == name {
+				found = metrics[i]
+				return true
+			}
+		}
+		return false
+	})
+	return found
+}
+
+// WaitForLog returns the first log record with the given body
+func (r *Receiver) WaitForLog(t testing.TB, body string, timeout time.Duration) *logspb.LogRecord {
+	t.Helper()
+	var found *logspb.LogRecord
+	waitFor(t, timeout, "log "+body, func() bool {
+		for _, l := range r.Logs() {
+			if l.GetBody().GetStringValue() == body {
+				found = l
+				return true
+			}
+		}
+		return false
+	})
+	return found
+}
+
+func waitFor(t testing.TB, timeout time.Duration, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out after %s waiting for %s", timeout, what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+type traceService struct {
+	coltracepb.UnimplementedTraceServiceServer
+	r *Receiver
+}
+
+func (s *traceService) Export(_ context.Context, req *coltracepb.ExportTraceServiceRequest) (*coltracepb.ExportTraceServiceResponse, error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	for _, rs := range req.ResourceSpans {
+		for _, ss := range rs.ScopeSpans {
+			s.r.spans = append(s.r.spans, ss.Spans...)
+		}
+	}
+	return &coltracepb.ExportTraceServiceResponse{}, nil
+}
+
+type metricsService struct {
+	colmetricspb.UnimplementedMetricsServiceServer
+	r *Receiver
+}
+
+func (s *metricsService) Export(_ context.Context, req *colmetricspb.ExportMetricsServiceRequest) (*colmetricspb.ExportMetricsServiceResponse, error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	for _, rm := range req.ResourceMetrics {
+		for _, sm := range rm.ScopeMetrics {
+			s.r.metrics = append(s.r.metrics, sm.Metrics...)
+		}
+	}
+	return &colmetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+type logsService struct {
+	collogspb.UnimplementedLogsServiceServer
+	r *Receiver
+}
+
+func (s *logsService) Export(_ context.Context, req *collogspb.ExportLogsServiceRequest) (*collogspb.ExportLogsServiceResponse, error) {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+	for _, rl := range req.ResourceLogs {
+		for _, sl := range rl.ScopeLogs {
+			s.r.logs = append(s.r.logs, sl.LogRecords...)
+		}
+	}
+	return &collogspb.ExportLogsServiceResponse{}, nil
+}
@@ -0,0 +1,37 @@
+package otel
+
+import (
+	"fmt"
+	"prom/app/config"
+	"strings"
+
+	"go.opentelemetry.io/contrib/propagators/aws/xray"
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// NewPropagator builds the composite of the propagators listed in OTEL_PROPAGATORS,
+// it is used to extract the inbound context and inject it in the outbound calls
+func NewPropagator(conf *config.AppConfig) (propagation.TextMapPropagator, error) {
+	var propagators []propagation.TextMapPropagator
+
+	for _, name := range conf.Propagators {
+		switch strings.TrimSpace(name) {
+		case "tracecontext":
+			propagators = append(propagators, propagation.TraceContext{})
+		case "baggage":
+			propagators = append(propagators, propagation.Baggage{})
+		case "b3":
+			propagators = append(propagators, b3.New())
+		case "b3multi":
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		case "xray":
+			propagators = append(propagators, xray.Propagator{})
+		case "none", "":
+		default:
+			return nil, fmt.Errorf("Unknown propagator %q", name)
+		}
+	}
+
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
@@ -0,0 +1,36 @@
+package otel
+
+import (
+	"context"
+	"net/http"
+	"prom/app/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNewPropagatorComposite(t *testing.T) {
+	p, err := NewPropagator(&config.AppConfig{Propagators: []string{"tracecontext", "baggage", "xray"}})
+	assert.NoError(t, err)
+
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	header.Set("baggage", "tenant=acme")
+	ctx := p.Extract(context.Background(), propagation.HeaderCarrier(header))
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", trace.SpanContextFromContext(ctx).TraceID().String())
+	assert.Equal(t, "acme", baggage.FromContext(ctx).Member("tenant").Value())
+
+	out := http.Header{}
+	p.Inject(ctx, propagation.HeaderCarrier(out))
+	assert.NotEmpty(t, out.Get("traceparent"))
+	assert.NotEmpty(t, out.Get("X-Amzn-Trace-Id"))
+}
+
+func TestNewPropagatorUnknown(t *testing.T) {
+	_, err := NewPropagator(&config.AppConfig{Propagators: []string{"jaeger"}})
+	assert.Error(t, err)
+}
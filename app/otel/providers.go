@@ -4,99 +4,122 @@ import (
 	"context"
 	"fmt"
 	"prom/app/config"
+	"time"
 
-	"github.com/uptrace/opentelemetry-go-extra/otelzap"
 	"go.opentelemetry.io/contrib/propagators/aws/xray"
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/unit"
 	"go.opentelemetry.io/otel/sdk/metric"
-	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/sdk/metric/aggregation"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
-	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-var conf = config.GetConfig()
-
-func InitTracer(ctx context.Context) func(context.Context) error {
+// dialCollector does not wait for the collector, the connection is established
+// and re-established in background so a late or restarting collector only
+// degrades the telemetry
+func dialCollector(ctx context.Context, conf *config.AppConfig) (*grpc.ClientConn, error) {
 	conn, err := grpc.DialContext(
 		ctx,
 		conf.OTELCollectorURL,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithBlock(),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.DefaultConfig,
+			MinConnectTimeout: 5 * time.Second,
+		}),
 	)
 	if err != nil {
-		otelzap.L().Fatal("Failed to create gRPC connection to collector:", zap.Error(err))
+		return nil, fmt.Errorf("Cannot create gRPC connection to collector: %w", err)
 	}
+	return conn, nil
+}
 
+func InitTracer(ctx context.Context, conf *config.AppConfig) (func(context.Context) error, error) {
 	// xray id generator
 	idg := xray.NewIDGenerator()
 
 	// Set up a trace exporter
-	var exporter sdktrace.SpanExporter
+	exporterRes := &exporterResources{}
+	exporter, err := newSpanExporter(ctx, conf, exporterRes)
+	if err != nil {
+		return nil, fmt.Errorf("Failed setting up the trace exporter: %w", err)
+	}
 
-	if conf.EnableOtelTraces {
-		exporter, err = otlptracegrpc.New(ctx, otlptracegrpc.WithGRPCConn(conn))
-	} else {
-		exporter, err = stdouttrace.New(stdouttrace.WithPrettyPrint())
+	propagator, err := NewPropagator(conf)
+	if err != nil {
+		return nil, fmt.Errorf("Failed setting up the propagators: %w", err)
 	}
 
+	res, err := NewResource(ctx, conf)
 	if err != nil {
-		otelzap.L().Fatal("Failed setting up the trace exporter:", zap.Error(err))
+		return nil, err
 	}
 
-	bsp := sdktrace.NewBatchSpanProcessor(
-		exporter,
-	)
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithSpanProcessor(bsp),
+	sampler, closeSampler, err := newSampler(ctx, conf, res)
+	if err != nil {
+		return nil, fmt.Errorf("Failed setting up the trace sampler: %w", err)
+	}
+
+	opts := []sdktrace.TracerProviderOption{
+		sdktrace.WithSampler(sampler),
 		sdktrace.WithIDGenerator(idg),
-		sdktrace.WithResource(
-			resource.NewWithAttributes(
-				semconv.SchemaURL,
-				semconv.ServiceNameKey.String(conf.ServiceName),
-			)),
-	)
+		sdktrace.WithResource(res),
+	}
+	if exporter != nil {
+		// The spans are buffered in memory up to the queue size while the collector is unavailable
+		opts = append(opts, sdktrace.WithSpanProcessor(newBoundedSpanProcessor(
+			exporter,
+			conf.TracesExportQueueSize,
+			sdktrace.WithMaxExportBatchSize(conf.TracesExportBatchSize),
+		)))
+	}
+	tp := sdktrace.NewTracerProvider(opts...)
 	otel.SetTracerProvider(tp)
 
-	otel.SetTextMapPropagator(xray.Propagator{})
+	otel.SetTextMapPropagator(propagator)
 
 	return func(ctx context.Context) error {
+		closeSampler()
 		if err := tp.Shutdown(ctx); err != nil {
 			return fmt.Errorf("Error shutting down tracer provider: %w", err)
 		}
-		return nil
-	}
+		return exporterRes.close()
+	}, nil
 }
 
-func InitMetricsProvider(ctx context.Context) func(context.Context) error {
-	exp, err := otlpmetricgrpc.New(ctx,
-		otlpmetricgrpc.WithInsecure(),
-		otlpmetricgrpc.WithEndpoint(conf.OTELCollectorURL),
-	)
+func InitMetricsProvider(ctx context.Context, conf *config.AppConfig) (func(context.Context) error, error) {
+	exporterRes := &exporterResources{}
+	readers, err := newMetricReaders(ctx, conf, exporterRes)
+	if err != nil {
+		return nil, err
+	}
 
+	res, err := NewResource(ctx, conf)
 	if err != nil {
-		otelzap.L().Fatal("Error configuring metrics provider", zap.Error(err))
+		return nil, err
 	}
-	meterProvider := metric.NewMeterProvider(metric.WithReader(metric.NewPeriodicReader(exp)),
-		metric.WithResource(resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String(conf.ServiceName),
-			semconv.CloudPlatformAWSEKS,
-			semconv.DBSystemMySQL,
-		)))
+
+	// Every latency histogram is recorded in milliseconds with the configured buckets
+	latencyView := metric.NewView(
+		metric.Instrument{Kind: metric.InstrumentKindSyncHistogram, Unit: unit.Milliseconds},
+		metric.Stream{Aggregation: aggregation.ExplicitBucketHistogram{Boundaries: conf.MetricsHistogramBuckets}},
+	)
+	meterProvider := metric.NewMeterProvider(append(readers,
+		metric.WithView(latencyView),
+		metric.WithResource(res))...)
 	global.SetMeterProvider(meterProvider)
 
-	return func(context.Context) error {
-		if err := meterProvider.Shutdown(context.Background()); err != nil {
+	if err := registerDegradedGauge(GetMeterInstance()); err != nil {
+		return nil, fmt.Errorf("Cannot register the telemetry degraded gauge: %w", err)
+	}
+
+	return func(ctx context.Context) error {
+		if err := meterProvider.Shutdown(ctx); err != nil {
 			return fmt.Errorf("Error shutting down metrics provider: %w", err)
 		}
-		return nil
-	}
+		return exporterRes.close()
+	}, nil
 }
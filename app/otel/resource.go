@@ -0,0 +1,131 @@
+package otel
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"prom/app/config"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+)
+
+// BuildInfo describes the running binary, the commit is embedded by the go
+// toolchain when building from a git checkout
+type BuildInfo struct {
+	Service     string `json:"service"`
+	Version     string `json:"version"`
+	Commit      string `json:"commit,omitempty"`
+	CommitTime  string `json:"commitTime,omitempty"`
+	Modified    bool   `json:"modified"`
+	GoVersion   string `json:"goVersion"`
+	Environment string `json:"environment"`
+}
+
+// ReadBuildInfo prefers SERVICE_VERSION and falls back on the module version
+func ReadBuildInfo(conf *config.AppConfig) BuildInfo {
+	info := BuildInfo{
+		Service:     conf.ServiceName,
+		Version:     conf.ServiceVersion,
+		GoVersion:   runtime.Version(),
+		Environment: conf.Environment,
+	}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	if (info.Version == "" || info.Version == "dev") && bi.Main.Version != "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Commit = s.Value
+		case "vcs.time":
+			info.CommitTime = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+// NewResource detects the attributes shared by every signal, the ones in
+// OTEL_RESOURCE_ATTRIBUTES take precedence over the detected ones, e.g.
+// cloud.platform=aws_eks is set there by the deployment
+func NewResource(ctx context.Context, conf *config.AppConfig) (*resource.Resource, error) {
+	info := ReadBuildInfo(conf)
+	attrs := []attribute.KeyValue{
+		semconv.ServiceNameKey.String(conf.ServiceName),
+		semconv.ServiceVersionKey.String(info.Version),
+		semconv.DeploymentEnvironmentKey.String(conf.Environment),
+	}
+	if info.Commit != "" {
+		attrs = append(attrs, attribute.String("vcs.revision", info.Commit))
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		// Not WithProcessCommandArgs nor owner, the args may contain secrets
+		resource.WithProcessPID(),
+		resource.WithProcessExecutableName(),
+		resource.WithProcessRuntimeName(),
+		resource.WithProcessRuntimeVersion(),
+		resource.WithContainer(),
+		resource.WithDetectors(k8sDetector{}),
+		resource.WithAttributes(attrs...),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		// Partial resources are still usable, e.g. outside of a container
+		if res == nil {
+			return nil, fmt.Errorf("Cannot detect the otel resource: %w", err)
+		}
+	}
+	return res, nil
+}
+
+const serviceAccountNamespace = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// k8sDetector reads the pod metadata exposed through the downward api as the
+// K8S_POD_NAME, K8S_NAMESPACE_NAME and K8S_NODE_NAME env vars
+type k8sDetector struct{}
+
+func (k8sDetector) Detect(ctx context.Context) (*resource.Resource, error) {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return resource.Empty(), nil
+	}
+
+	var attrs []attribute.KeyValue
+	if pod := os.Getenv("K8S_POD_NAME"); pod != "" {
+		attrs = append(attrs, semconv.K8SPodNameKey.String(pod))
+	} else if host, err := os.Hostname(); err == nil {
+		// The hostname of a pod is its name unless overridden in the spec
+		attrs = append(attrs, semconv.K8SPodNameKey.String(host))
+	}
+	if uid := os.Getenv("K8S_POD_UID"); uid != "" {
+		attrs = append(attrs, semconv.K8SPodUIDKey.String(uid))
+	}
+
+	namespace := os.Getenv("K8S_NAMESPACE_NAME")
+	if namespace == "" {
+		if b, err := os.ReadFile(serviceAccountNamespace); err == nil {
+			namespace = strings.TrimSpace(string(b))
+		}
+	}
+	if namespace != "" {
+		attrs = append(attrs, semconv.K8SNamespaceNameKey.String(namespace))
+	}
+	if node := os.Getenv("K8S_NODE_NAME"); node != "" {
+		attrs = append(attrs, semconv.K8SNodeNameKey.String(node))
+	}
+
+	return resource.NewWithAttributes(semconv.SchemaURL, attrs...), nil
+}
@@ -0,0 +1,50 @@
+package otel
+
+import (
+	"context"
+	"prom/app/config"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+func TestNewResource(t *testing.T) {
+	t.Setenv("OTEL_RESOURCE_ATTRIBUTES", "cloud.platform=aws_eks,deployment.environment=production")
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	t.Setenv("K8S_POD_NAME", "ms-baselines-golang-7d9f")
+	t.Setenv("K8S_NAMESPACE_NAME", "baselines")
+
+	res, err := NewResource(context.Background(), &config.AppConfig{
+		ServiceName:    "ms-baselines-golang",
+		ServiceVersion: "1.2.3",
+		Environment:    "local",
+	})
+	assert.NoError(t, err)
+
+	attrs := map[attribute.Key]string{}
+	for _, kv := range res.Attributes() {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+	assert.Equal(t, "ms-baselines-golang", attrs["service.name"])
+	assert.Equal(t, "1.2.3", attrs["service.version"])
+	assert.Equal(t, "aws_eks", attrs["cloud.platform"])
+	// OTEL_RESOURCE_ATTRIBUTES takes precedence over the config
+	assert.Equal(t, "production", attrs["deployment.environment"])
+	assert.Equal(t, "ms-baselines-golang-7d9f", attrs["k8s.pod.name"])
+	assert.Equal(t, "baselines", attrs["k8s.namespace.name"])
+	assert.NotEmpty(t, attrs["host.name"])
+	assert.NotEmpty(t, attrs["process.pid"])
+}
+
+func TestNewResourceOutsideKubernetes(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+	res, err := NewResource(context.Background(), &config.AppConfig{ServiceName: "ms-baselines-golang"})
+	assert.NoError(t, err)
+
+	for _, kv := range res.Attributes() {
+		assert.NotEqual(t, attribute.Key("cloud.platform"), kv.Key)
+		assert.NotEqual(t, attribute.Key("k8s.pod.name"), kv.Key)
+	}
+}
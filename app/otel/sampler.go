@@ -0,0 +1,33 @@
+package otel
+
+import (
+	"context"
+	"fmt"
+	"prom/app/config"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// newSampler builds the sampler selected by TRACES_SAMPLER, the returned close
+// func stops the background work of the sampler if it has any
+func newSampler(ctx context.Context, conf *config.AppConfig, res *resource.Resource) (sdktrace.Sampler, func(), error) {
+	noop := func() {}
+
+	switch conf.TracesSampler {
+	case "always_on":
+		return sdktrace.AlwaysSample(), noop, nil
+	case "always_off":
+		return sdktrace.NeverSample(), noop, nil
+	case "parentbased_traceidratio":
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(conf.TracesSamplerRatio)), noop, nil
+	case "xray":
+		remote, err := newXRayRemoteSampler(ctx, conf, res)
+		if err != nil {
+			return nil, nil, err
+		}
+		return sdktrace.ParentBased(remote), remote.Close, nil
+	default:
+		return nil, nil, fmt.Errorf("Unknown traces sampler %q", conf.TracesSampler)
+	}
+}
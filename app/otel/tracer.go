@@ -1,13 +1,16 @@
 package otel
 
 import (
-	"prom/app/config"
 	"sync"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// InstrumentationName identifies the spans created by this module, the service
+// name is set on the resource by InitTracer
+const InstrumentationName = "prom"
+
 var tracerSingleLock = &sync.Mutex{}
 
 var tracerInstance trace.Tracer
@@ -18,7 +21,7 @@ func GetTracerInstance() trace.Tracer {
 
 		defer tracerSingleLock.Unlock()
 		if tracerInstance == nil {
-			tracerInstance = otel.Tracer(config.GetConfig().ServiceName)
+			tracerInstance = otel.Tracer(InstrumentationName)
 		}
 	}
 	return tracerInstance
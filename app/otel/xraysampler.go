@@ -0,0 +1,483 @@
+package otel
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"prom/app/config"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconvres "go.opentelemetry.io/otel/semconv/v1.12.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// xraySamplingRule is a rule as returned by the GetSamplingRules api of X-Ray,
+// the collector proxies it in the port 2000
+type xraySamplingRule struct {
+	RuleName      string            `json:"RuleName"`
+	Priority      int               `json:"Priority"`
+	FixedRate     float64           `json:"FixedRate"`
+	ReservoirSize int64             `json:"ReservoirSize"`
+	ServiceName   string            `json:"ServiceName"`
+	ServiceType   string            `json:"ServiceType"`
+	Host          string            `json:"Host"`
+	HTTPMethod    string            `json:"HTTPMethod"`
+	URLPath       string            `json:"URLPath"`
+	Attributes    map[string]string `json:"Attributes"`
+}
+
+type xraySamplingRulesResponse struct {
+	SamplingRuleRecords []struct {
+		SamplingRule xraySamplingRule `json:"SamplingRule"`
+	} `json:"SamplingRuleRecords"`
+	NextToken *string `json:"NextToken"`
+}
+
+// xraySamplingTarget is the quota assigned to a rule by the SamplingTargets api
+type xraySamplingTarget struct {
+	RuleName          string   `json:"RuleName"`
+	FixedRate         float64  `json:"FixedRate"`
+	ReservoirQuota    *int64   `json:"ReservoirQuota"`
+	ReservoirQuotaTTL *float64 `json:"ReservoirQuotaTTL"`
+	Interval          *int64   `json:"Interval"`
+}
+
+type xraySamplingTargetsResponse struct {
+	SamplingTargetDocuments []xraySamplingTarget `json:"SamplingTargetDocuments"`
+	LastRuleModification    float64              `json:"LastRuleModification"`
+}
+
+type xraySamplingStatistics struct {
+	ClientID     string  `json:"ClientID"`
+	RuleName     string  `json:"RuleName"`
+	RequestCount int64   `json:"RequestCount"`
+	SampledCount int64   `json:"SampledCount"`
+	BorrowCount  int64   `json:"BorrowCount"`
+	Timestamp    float64 `json:"Timestamp"`
+}
+
+// xrayRule applies a sampling rule, until X-Ray assigns a reservoir quota to
+// this instance it borrows one trace per second from the reservoir
+type xrayRule struct {
+	xraySamplingRule
+
+	mu          sync.Mutex
+	ratio       sdktrace.Sampler
+	quota       int64
+	quotaExpiry time.Time
+	second      int64
+	used        int64
+
+	requests int64
+	sampled  int64
+	borrowed int64
+}
+
+func newXRayRule(r xraySamplingRule) *xrayRule {
+	return &xrayRule{
+		xraySamplingRule: r,
+		ratio:            sdktrace.TraceIDRatioBased(r.FixedRate),
+	}
+}
+
+// sample counts the request in the statistics of the rule and decides with
+// the reservoir first, then with the fixed rate
+func (r *xrayRule) sample(p sdktrace.SamplingParameters, now time.Time) sdktrace.SamplingResult {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.requests++
+	if now.Unix() != r.second {
+		r.second = now.Unix()
+		r.used = 0
+	}
+
+	borrowing := r.quotaExpiry.IsZero() || !now.Before(r.quotaExpiry)
+	capacity := r.quota
+	if borrowing {
+		capacity = 0
+		if r.ReservoirSize > 0 {
+			capacity = 1
+		}
+	}
+	if r.used < capacity {
+		r.used++
+		r.sampled++
+		if borrowing {
+			r.borrowed++
+		}
+		return sdktrace.SamplingResult{
+			Decision:   sdktrace.RecordAndSample,
+			Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+		}
+	}
+
+	res := r.ratio.ShouldSample(p)
+	if res.Decision == sdktrace.RecordAndSample {
+		r.sampled++
+	}
+	return res
+}
+
+// statistics returns the counters since the previous report and resets them
+func (r *xrayRule) statistics(clientID string, now time.Time) xraySamplingStatistics {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stats := xraySamplingStatistics{
+		ClientID:     clientID,
+		RuleName:     r.RuleName,
+		RequestCount: r.requests,
+		SampledCount: r.sampled,
+		BorrowCount:  r.borrowed,
+		Timestamp:    float64(now.Unix()),
+	}
+	r.requests, r.sampled, r.borrowed = 0, 0, 0
+	return stats
+}
+
+func (r *xrayRule) applyTarget(t xraySamplingTarget) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ratio = sdktrace.TraceIDRatioBased(t.FixedRate)
+	if t.ReservoirQuota != nil && t.ReservoirQuotaTTL != nil {
+		r.quota = *t.ReservoirQuota
+		r.quotaExpiry = time.Unix(0, int64(*t.ReservoirQuotaTTL*float64(time.Second)))
+	}
+}
+
+// inherit keeps the quota assigned to the same rule before the rules were refreshed
+func (r *xrayRule) inherit(prev *xrayRule) {
+	prev.mu.Lock()
+	defer prev.mu.Unlock()
+	if prev.FixedRate == r.FixedRate && prev.ReservoirSize == r.ReservoirSize {
+		r.ratio = prev.ratio
+		r.quota = prev.quota
+		r.quotaExpiry = prev.quotaExpiry
+	}
+	r.requests, r.sampled, r.borrowed = prev.requests, prev.sampled, prev.borrowed
+}
+
+func (r *xrayRule) matches(serviceName, serviceType string, attrs map[attribute.Key]string) bool {
+	path := attrs[semconv.HTTPTargetKey]
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+
+	if !wildcardMatch(r.ServiceName, serviceName) ||
+		!wildcardMatch(r.ServiceType, serviceType) ||
+		!wildcardMatch(r.HTTPMethod, attrs[semconv.HTTPMethodKey]) ||
+		!wildcardMatch(r.URLPath, path) ||
+		!wildcardMatch(r.Host, attrs[semconv.NetHostNameKey]) {
+		return false
+	}
+
+	for k, v := range r.Attributes {
+		if !wildcardMatch(v, attrs[attribute.Key(k)]) {
+			return false
+		}
+	}
+	return true
+}
+
+// xrayServiceType maps the cloud platform of the resource to the X-Ray
+// service type matched by the ServiceType of the rules
+func xrayServiceType(res *resource.Resource) string {
+	var platform string
+	for _, kv := range res.Attributes() {
+		if kv.Key == semconvres.CloudPlatformKey {
+			platform = kv.Value.AsString()
+		}
+	}
+	switch platform {
+	case semconvres.CloudPlatformAWSEC2.Value.AsString():
+		return "AWS::EC2::Instance"
+	case semconvres.CloudPlatformAWSECS.Value.AsString():
+		return "AWS::ECS::Container"
+	case semconvres.CloudPlatformAWSEKS.Value.AsString():
+		return "AWS::EKS::Container"
+	case semconvres.CloudPlatformAWSLambda.Value.AsString():
+		return "AWS::Lambda::Function"
+	case semconvres.CloudPlatformAWSElasticBeanstalk.Value.AsString():
+		return "AWS::ElasticBeanstalk::Environment"
+	default:
+		return ""
+	}
+}
+
+// xrayTargetsInterval is how often the statistics of the rules are reported
+// to X-Ray in exchange for their reservoir quota and fixed rate
+const xrayTargetsInterval = 10 * time.Second
+
+// xrayRemoteSampler samples with the rules centrally managed in X-Ray, the
+// fallback ratio is used until rules are fetched or when they are too old
+type xrayRemoteSampler struct {
+	serviceName     string
+	serviceType     string
+	clientID        string
+	endpoint        string
+	interval        time.Duration
+	targetsInterval time.Duration
+	fallback        sdktrace.Sampler
+	client          *http.Client
+
+	mu        sync.RWMutex
+	rules     []*xrayRule
+	fetchedAt time.Time
+
+	stop chan struct{}
+	once sync.Once
+}
+
+func newXRayRemoteSampler(ctx context.Context, conf *config.AppConfig, res *resource.Resource) (*xrayRemoteSampler, error) {
+	if conf.XRaySamplingInterval <= 0 {
+		return nil, fmt.Errorf("Invalid xray sampling interval %s", conf.XRaySamplingInterval)
+	}
+
+	clientID := make([]byte, 12)
+	if _, err := rand.Read(clientID); err != nil {
+		return nil, fmt.Errorf("Cannot generate the xray sampling client id: %w", err)
+	}
+
+	s := &xrayRemoteSampler{
+		serviceName:     conf.ServiceName,
+		serviceType:     xrayServiceType(res),
+		clientID:        hex.EncodeToString(clientID),
+		endpoint:        strings.TrimSuffix(conf.XRaySamplingURL, "/"),
+		interval:        conf.XRaySamplingInterval,
+		targetsInterval: xrayTargetsInterval,
+		fallback:        sdktrace.TraceIDRatioBased(conf.TracesSamplerFallbackRatio),
+		client:          &http.Client{Timeout: 5 * time.Second},
+		stop:            make(chan struct{}),
+	}
+
+	go s.poll(ctx)
+
+	return s, nil
+}
+
+func (s *xrayRemoteSampler) poll(ctx context.Context) {
+	rulesTicker := time.NewTicker(s.interval)
+	defer rulesTicker.Stop()
+	targetsTicker := time.NewTicker(s.targetsInterval)
+	defer targetsTicker.Stop()
+
+	refresh := func() {
+		if err := s.refresh(ctx); err != nil {
+			log.Printf("Cannot fetch xray sampling rules, sampling with the fallback ratio: %v", err)
+		}
+	}
+
+	refresh()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.stop:
+			return
+		case <-rulesTicker.C:
+			refresh()
+		case <-targetsTicker.C:
+			modified, err := s.reportTargets(ctx)
+			if err != nil {
+				log.Printf("Cannot fetch xray sampling targets: %v", err)
+				continue
+			}
+			if modified {
+				refresh()
+			}
+		}
+	}
+}
+
+// post calls an api of the X-Ray sampling proxy with a json body
+func (s *xrayRemoteSampler) post(ctx context.Context, api string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.endpoint+"/"+api, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", api, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("Cannot decode %s response: %w", api, err)
+	}
+	return nil
+}
+
+func (s *xrayRemoteSampler) refresh(ctx context.Context) error {
+	var rules []*xrayRule
+	var nextToken *string
+
+	for {
+		var out xraySamplingRulesResponse
+		if err := s.post(ctx, "GetSamplingRules", map[string]*string{"NextToken": nextToken}, &out); err != nil {
+			return err
+		}
+
+		for _, record := range out.SamplingRuleRecords {
+			rules = append(rules, newXRayRule(record.SamplingRule))
+		}
+
+		if out.NextToken == nil || *out.NextToken == "" {
+			break
+		}
+		nextToken = out.NextToken
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority == rules[j].Priority {
+			return rules[i].RuleName < rules[j].RuleName
+		}
+		return rules[i].Priority < rules[j].Priority
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := make(map[string]*xrayRule, len(s.rules))
+	for _, rule := range s.rules {
+		previous[rule.RuleName] = rule
+	}
+	for _, rule := range rules {
+		if prev, ok := previous[rule.RuleName]; ok {
+			rule.inherit(prev)
+		}
+	}
+	s.rules = rules
+	s.fetchedAt = time.Now()
+	return nil
+}
+
+// reportTargets sends the statistics of the rules to SamplingTargets and applies
+// the returned quotas, it reports whether the rules changed since they were fetched
+func (s *xrayRemoteSampler) reportTargets(ctx context.Context) (bool, error) {
+	now := time.Now()
+
+	s.mu.RLock()
+	rules := s.rules
+	fetchedAt := s.fetchedAt
+	s.mu.RUnlock()
+	if len(rules) == 0 {
+		return false, nil
+	}
+
+	byName := make(map[string]*xrayRule, len(rules))
+	stats := make([]xraySamplingStatistics, 0, len(rules))
+	for _, rule := range rules {
+		byName[rule.RuleName] = rule
+		stats = append(stats, rule.statistics(s.clientID, now))
+	}
+
+	var out xraySamplingTargetsResponse
+	if err := s.post(ctx, "SamplingTargets", map[string]interface{}{"SamplingStatisticsDocuments": stats}, &out); err != nil {
+		return false, err
+	}
+
+	for _, target := range out.SamplingTargetDocuments {
+		if rule, ok := byName[target.RuleName]; ok {
+			rule.applyTarget(target)
+		}
+	}
+
+	modified := time.Unix(0, int64(out.LastRuleModification*float64(time.Second)))
+	return modified.After(fetchedAt), nil
+}
+
+// activeRules returns nil when the rules have expired after missing two polls
+func (s *xrayRemoteSampler) activeRules(now time.Time) []*xrayRule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.fetchedAt.IsZero() || now.Sub(s.fetchedAt) > 2*s.interval {
+		return nil
+	}
+	return s.rules
+}
+
+func (s *xrayRemoteSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	now := time.Now()
+	rules := s.activeRules(now)
+	if len(rules) == 0 {
+		return s.fallback.ShouldSample(p)
+	}
+
+	attrs := make(map[attribute.Key]string, len(p.Attributes))
+	for _, kv := range p.Attributes {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+
+	for _, rule := range rules {
+		if rule.matches(s.serviceName, s.serviceType, attrs) {
+			return rule.sample(p, now)
+		}
+	}
+
+	return s.fallback.ShouldSample(p)
+}
+
+func (s *xrayRemoteSampler) Description() string {
+	return "XRayRemoteSampler{" + s.endpoint + "}"
+}
+
+func (s *xrayRemoteSampler) Close() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+}
+
+// wildcardMatch matches the X-Ray rule patterns, * matches any number of
+// characters and ? a single one, the comparison is case insensitive
+func wildcardMatch(pattern, value string) bool {
+	if pattern == "" || pattern == "*" {
+		return true
+	}
+	p := []rune(strings.ToLower(pattern))
+	v := []rune(strings.ToLower(value))
+
+	pi, vi := 0, 0
+	star, match := -1, 0
+	for vi < len(v) {
+		switch {
+		case pi < len(p) && (p[pi] == '?' || p[pi] == v[vi]):
+			pi++
+			vi++
+		case pi < len(p) && p[pi] == '*':
+			star = pi
+			match = vi
+			pi++
+		case star != -1:
+			pi = star + 1
+			match++
+			vi = match
+		default:
+			return false
+		}
+	}
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
@@ -0,0 +1,180 @@
+package otel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"prom/app/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconvres "go.opentelemetry.io/otel/semconv/v1.12.0"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const samplingRules = `{
+	"SamplingRuleRecords": [
+		{"SamplingRule": {"RuleName": "Default", "Priority": 10000, "FixedRate": 0, "ReservoirSize": 0,
+			"ServiceName": "*", "ServiceType": "*", "Host": "*", "HTTPMethod": "*", "URLPath": "*"}},
+		{"SamplingRule": {"RuleName": "users", "Priority": 1, "FixedRate": 1, "ReservoirSize": 0,
+			"ServiceName": "ms-*", "ServiceType": "*", "Host": "*", "HTTPMethod": "GET", "URLPath": "/v1/user*"}}
+	]
+}`
+
+func samplingParams(method, target string) sdktrace.SamplingParameters {
+	return sdktrace.SamplingParameters{
+		ParentContext: context.Background(),
+		TraceID:       trace.TraceID{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+		Name:          "span",
+		Attributes: []attribute.KeyValue{
+			semconv.HTTPMethodKey.String(method),
+			semconv.HTTPTargetKey.String(target),
+		},
+	}
+}
+
+func testXRayConfig(url string, fallback float64) *config.AppConfig {
+	return &config.AppConfig{
+		ServiceName:                "ms-baselines-golang",
+		XRaySamplingURL:            url,
+		XRaySamplingInterval:       time.Minute,
+		TracesSamplerFallbackRatio: fallback,
+	}
+}
+
+func TestXRayRemoteSamplerRules(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/GetSamplingRules", r.URL.Path)
+		w.Write([]byte(samplingRules))
+	}))
+	defer srv.Close()
+
+	s, err := newXRayRemoteSampler(context.Background(), testXRayConfig(srv.URL, 0), nil)
+	assert.NoError(t, err)
+	defer s.Close()
+	assert.Eventually(t, func() bool { return s.activeRules(time.Now()) != nil }, time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, sdktrace.RecordAndSample, s.ShouldSample(samplingParams("GET", "/v1/user/1?x=1")).Decision)
+	assert.Equal(t, sdktrace.Drop, s.ShouldSample(samplingParams("DELETE", "/v1/user/1")).Decision)
+	assert.Equal(t, sdktrace.Drop, s.ShouldSample(samplingParams("GET", "/swagger/index.html")).Decision)
+}
+
+func TestXRayRemoteSamplerFallback(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	s, err := newXRayRemoteSampler(context.Background(), testXRayConfig(srv.URL, 1), nil)
+	assert.NoError(t, err)
+	defer s.Close()
+
+	assert.Equal(t, sdktrace.RecordAndSample, s.ShouldSample(samplingParams("DELETE", "/v1/user/1")).Decision)
+}
+
+func TestXRayRemoteSamplerServiceType(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"SamplingRuleRecords": [
+			{"SamplingRule": {"RuleName": "eks", "Priority": 1, "FixedRate": 1, "ReservoirSize": 0,
+				"ServiceName": "*", "ServiceType": "AWS::EKS::Container", "Host": "*", "HTTPMethod": "*", "URLPath": "*"}}
+		]}`))
+	}))
+	defer srv.Close()
+
+	cases := map[string]struct {
+		res      *resource.Resource
+		decision sdktrace.SamplingDecision
+	}{
+		"matching platform": {resource.NewSchemaless(semconvres.CloudPlatformAWSEKS), sdktrace.RecordAndSample},
+		"other platform":    {resource.NewSchemaless(semconvres.CloudPlatformAWSEC2), sdktrace.Drop},
+		"unknown platform":  {resource.Empty(), sdktrace.Drop},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			s, err := newXRayRemoteSampler(context.Background(), testXRayConfig(srv.URL, 0), tc.res)
+			assert.NoError(t, err)
+			defer s.Close()
+			assert.Eventually(t, func() bool { return s.activeRules(time.Now()) != nil }, time.Second, 10*time.Millisecond)
+
+			assert.Equal(t, tc.decision, s.ShouldSample(samplingParams("GET", "/v1/user")).Decision)
+		})
+	}
+}
+
+func TestXRayRemoteSamplerTargets(t *testing.T) {
+	reported := make(chan []xraySamplingStatistics, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/GetSamplingRules":
+			w.Write([]byte(`{"SamplingRuleRecords": [
+				{"SamplingRule": {"RuleName": "users", "Priority": 1, "FixedRate": 0, "ReservoirSize": 10,
+					"ServiceName": "*", "ServiceType": "*", "Host": "*", "HTTPMethod": "*", "URLPath": "*"}}
+			]}`))
+		case "/SamplingTargets":
+			var in struct {
+				SamplingStatisticsDocuments []xraySamplingStatistics
+			}
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&in))
+			reported <- in.SamplingStatisticsDocuments
+			w.Write([]byte(fmt.Sprintf(`{"SamplingTargetDocuments": [
+				{"RuleName": "users", "FixedRate": 0, "ReservoirQuota": 3, "ReservoirQuotaTTL": %d}
+			]}`, time.Now().Add(time.Hour).Unix())))
+		default:
+			t.Errorf("Unexpected xray api %s", r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+
+	s, err := newXRayRemoteSampler(context.Background(), testXRayConfig(srv.URL, 0), nil)
+	assert.NoError(t, err)
+	defer s.Close()
+	assert.Eventually(t, func() bool { return s.activeRules(time.Now()) != nil }, time.Second, 10*time.Millisecond)
+
+	// Without a quota a single trace per second is borrowed from the reservoir
+	decisions := make([]sdktrace.SamplingDecision, 3)
+	for i := range decisions {
+		decisions[i] = s.ShouldSample(samplingParams("GET", "/v1/user")).Decision
+	}
+	assert.Equal(t, []sdktrace.SamplingDecision{sdktrace.RecordAndSample, sdktrace.Drop, sdktrace.Drop}, decisions)
+
+	modified, err := s.reportTargets(context.Background())
+	assert.NoError(t, err)
+	assert.False(t, modified)
+	stats := <-reported
+	if assert.Len(t, stats, 1) {
+		assert.Equal(t, "users", stats[0].RuleName)
+		assert.Equal(t, s.clientID, stats[0].ClientID)
+		assert.Equal(t, int64(3), stats[0].RequestCount)
+		assert.Equal(t, int64(1), stats[0].SampledCount)
+		assert.Equal(t, int64(1), stats[0].BorrowCount)
+	}
+
+	// The assigned quota replaces the borrowing, the statistics were reset by the report
+	rule := s.activeRules(time.Now())[0]
+	rule.mu.Lock()
+	rule.second, rule.used = 0, 0
+	rule.mu.Unlock()
+	sampled := 0
+	for i := 0; i < 5; i++ {
+		if s.ShouldSample(samplingParams("GET", "/v1/user")).Decision == sdktrace.RecordAndSample {
+			sampled++
+		}
+	}
+	assert.Equal(t, 3, sampled)
+	assert.Equal(t, int64(5), rule.statistics(s.clientID, time.Now()).RequestCount)
+}
+
+func TestWildcardMatch(t *testing.T) {
+	assert.True(t, wildcardMatch("*", "anything"))
+	assert.True(t, wildcardMatch("/v1/user/*", "/v1/user/10"))
+	assert.True(t, wildcardMatch("GE?", "get"))
+	assert.False(t, wildcardMatch("/v1/user/*", "/v2/user/10"))
+	assert.False(t, wildcardMatch("POST", "GET"))
+}
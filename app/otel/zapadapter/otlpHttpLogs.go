@@ -0,0 +1,93 @@
+package zap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"prom/app/config"
+	appotel "prom/app/otel"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// httpLogsClient posts the batches as protobuf to the /v1/logs path of the
+// collector, with the same settings as the otlphttp trace and metric exporters
+type httpLogsClient struct {
+	url      string
+	headers  map[string]string
+	compress bool
+	client   *http.Client
+}
+
+func newHttpLogsClient(conf *config.AppConfig) (*httpLogsClient, error) {
+	scheme := "http"
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !conf.OTLPHTTPInsecure {
+		tlsConf, err := appotel.OTLPHTTPTLSConfig(conf)
+		if err != nil {
+			return nil, err
+		}
+		scheme = "https"
+		transport.TLSClientConfig = tlsConf
+	}
+
+	return &httpLogsClient{
+		url:      fmt.Sprintf("%s://%s/v1/logs", scheme, conf.OTLPHTTPEndpoint),
+		headers:  conf.OTLPHTTPHeaders,
+		compress: conf.OTLPHTTPCompression == "gzip",
+		client:   &http.Client{Transport: transport, Timeout: 10 * time.Second},
+	}, nil
+}
+
+func (c *httpLogsClient) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("Cannot marshal log records: %w", err)
+	}
+
+	if c.compress {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(body); err != nil {
+			return err
+		}
+		if err := gz.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	if c.compress {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+	for k, v := range c.headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	resp, err := c.client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (c *httpLogsClient) Close() error {
+	c.client.CloseIdleConnections()
+	return nil
+}
@@ -0,0 +1,50 @@
+package zap
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"prom/app/config"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestHttpLogsClient(t *testing.T) {
+	received := &collogspb.ExportLogsServiceRequest{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/logs", r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("Api-Key"))
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+
+		gz, err := gzip.NewReader(r.Body)
+		assert.NoError(t, err)
+		body, err := io.ReadAll(gz)
+		assert.NoError(t, err)
+		assert.NoError(t, proto.Unmarshal(body, received))
+	}))
+	defer srv.Close()
+
+	client, err := newHttpLogsClient(&config.AppConfig{
+		OTLPHTTPEndpoint:    strings.TrimPrefix(srv.URL, "http://"),
+		OTLPHTTPHeaders:     map[string]string{"Api-Key": "secret"},
+		OTLPHTTPCompression: "gzip",
+		OTLPHTTPInsecure:    true,
+	})
+	assert.NoError(t, err)
+
+	err = client.Export(context.Background(), &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{ScopeLogs: []*logspb.ScopeLogs{{
+			LogRecords: []*logspb.LogRecord{{SeverityText: "INFO"}},
+		}}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "INFO", received.ResourceLogs[0].ScopeLogs[0].LogRecords[0].SeverityText)
+}
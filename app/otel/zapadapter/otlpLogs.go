@@ -0,0 +1,363 @@
+package zap
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	appotel "prom/app/otel"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/resource"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+const (
+	traceIdField   = "trace-id"
+	spanIdField    = "span-id"
+	requestIdField = "request-id"
+	tenantIdField  = "tenant-id"
+	baggagePrefix  = "baggage."
+)
+
+// otlpLogExporter batches the log records and ships them to the collector, the
+// queue is bounded and records are dropped instead of blocking the callers
+type otlpLogExporter struct {
+	client    logsClient
+	resource  *resourcepb.Resource
+	queue     chan *logspb.LogRecord
+	flushReq  chan chan struct{}
+	batchSize int
+	interval  time.Duration
+	dropped   atomic.Int64
+
+	stop     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+// logsClient sends the batches to the collector over grpc or http
+type logsClient interface {
+	Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error
+	Close() error
+}
+
+type grpcLogsClient struct {
+	conn   *grpc.ClientConn
+	client collogspb.LogsServiceClient
+}
+
+func newGrpcLogsClient(endpoint string) (*grpcLogsClient, error) {
+	// Not blocking, the connection is established in background
+	conn, err := grpc.Dial(endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, fmt.Errorf("Cannot create gRPC connection for logs: %w", err)
+	}
+	return &grpcLogsClient{conn: conn, client: collogspb.NewLogsServiceClient(conn)}, nil
+}
+
+func (c *grpcLogsClient) Export(ctx context.Context, req *collogspb.ExportLogsServiceRequest) error {
+	_, err := c.client.Export(ctx, req)
+	return err
+}
+
+func (c *grpcLogsClient) Close() error {
+	return c.conn.Close()
+}
+
+func newOtlpLogExporter(client logsClient, res *resource.Resource, queueSize, batchSize int, interval time.Duration) (*otlpLogExporter, error) {
+	if queueSize <= 0 || batchSize <= 0 || interval <= 0 {
+		return nil, fmt.Errorf("Invalid log export settings queue=%d batch=%d interval=%s", queueSize, batchSize, interval)
+	}
+
+	e := &otlpLogExporter{
+		client:    client,
+		resource:  toResource(res),
+		queue:     make(chan *logspb.LogRecord, queueSize),
+		flushReq:  make(chan chan struct{}),
+		batchSize: batchSize,
+		interval:  interval,
+		stop:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	go e.run()
+
+	return e, nil
+}
+
+func (e *otlpLogExporter) enqueue(record *logspb.LogRecord) {
+	select {
+	case e.queue <- record:
+	default:
+		e.dropped.Add(1)
+	}
+}
+
+func (e *otlpLogExporter) run() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	batch := make([]*logspb.LogRecord, 0, e.batchSize)
+	export := func() {
+		if dropped := e.dropped.Swap(0); dropped > 0 {
+			log.Printf("Log export queue is full, dropped %d log records", dropped)
+			appotel.RecordDropped(context.Background(), "logs", "queue_full", int(dropped))
+		}
+		if len(batch) == 0 {
+			return
+		}
+		e.export(batch)
+		batch = make([]*logspb.LogRecord, 0, e.batchSize)
+	}
+
+	drain := func() {
+		for {
+			select {
+			case record := <-e.queue:
+				batch = append(batch, record)
+				if len(batch) >= e.batchSize {
+					export()
+				}
+			default:
+				export()
+				return
+			}
+		}
+	}
+
+	for {
+		select {
+		case record := <-e.queue:
+			batch = append(batch, record)
+			if len(batch) >= e.batchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case done := <-e.flushReq:
+			drain()
+			close(done)
+		case <-e.stop:
+			drain()
+			if err := e.client.Close(); err != nil {
+				log.Printf("Cannot close the log exporter client: %v", err)
+			}
+			return
+		}
+	}
+}
+
+func (e *otlpLogExporter) export(batch []*logspb.LogRecord) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := e.client.Export(ctx, &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: e.resource,
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope:      &commonpb.InstrumentationScope{Name: "prom"},
+				LogRecords: batch,
+			}},
+		}},
+	})
+	appotel.RecordExport(ctx, "logs", len(batch), err)
+}
+
+// flush exports the queued records, it gives up when the context is done
+func (e *otlpLogExporter) flush(ctx context.Context) error {
+	done := make(chan struct{})
+	select {
+	case e.flushReq <- done:
+	case <-e.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shutdown exports the queued records, stops the export loop and closes the
+// client, the records logged afterwards are dropped
+func (e *otlpLogExporter) shutdown(ctx context.Context) error {
+	e.stopOnce.Do(func() {
+		close(e.stop)
+	})
+	select {
+	case <-e.stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// otlpCore is a zapcore.Core writing the entries to an otlpLogExporter
+type otlpCore struct {
+	zapcore.LevelEnabler
+	fields   []zapcore.Field
+	exporter *otlpLogExporter
+}
+
+func newOtlpCore(enab zapcore.LevelEnabler, exporter *otlpLogExporter) *otlpCore {
+	return &otlpCore{LevelEnabler: enab, exporter: exporter}
+}
+
+func (c *otlpCore) With(fields []zapcore.Field) zapcore.Core {
+	return &otlpCore{
+		LevelEnabler: c.LevelEnabler,
+		fields:       append(c.fields[:len(c.fields):len(c.fields)], fields...),
+		exporter:     c.exporter,
+	}
+}
+
+func (c *otlpCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+func (c *otlpCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	all := append(c.fields[:len(c.fields):len(c.fields)], fields...)
+	c.exporter.enqueue(toLogRecord(ent, all))
+	return nil
+}
+
+func (c *otlpCore) Sync() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return c.exporter.flush(ctx)
+}
+
+// toResource shares the resource of the traces and metrics with the logs
+func toResource(res *resource.Resource) *resourcepb.Resource {
+	attrs := make([]*commonpb.KeyValue, 0, res.Len())
+	for _, kv := range res.Attributes() {
+		attrs = append(attrs, &commonpb.KeyValue{Key: string(kv.Key), Value: toAnyValue(kv.Value.AsInterface())})
+	}
+	return &resourcepb.Resource{Attributes: attrs}
+}
+
+func severityNumber(level zapcore.Level) logspb.SeverityNumber {
+	switch level {
+	case zapcore.DebugLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG
+	case zapcore.InfoLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_INFO
+	case zapcore.WarnLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_WARN
+	case zapcore.ErrorLevel:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_ERROR
+	default:
+		return logspb.SeverityNumber_SEVERITY_NUMBER_FATAL
+	}
+}
+
+// toLogRecord converts a zap entry, the trace-id and span-id fields added by
+// ZapLogger become the trace context of the record instead of attributes
+func toLogRecord(ent zapcore.Entry, fields []zapcore.Field) *logspb.LogRecord {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+
+	record := &logspb.LogRecord{
+		TimeUnixNano:         uint64(ent.Time.UnixNano()),
+		ObservedTimeUnixNano: uint64(time.Now().UnixNano()),
+		SeverityNumber:       severityNumber(ent.Level),
+		SeverityText:         ent.Level.CapitalString(),
+		Body:                 &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: ent.Message}},
+	}
+
+	for k, v := range enc.Fields {
+		switch k {
+		case traceIdField:
+			if id, err := hex.DecodeString(fmt.Sprint(v)); err == nil {
+				record.TraceId = id
+				continue
+			}
+		case spanIdField:
+			if id, err := hex.DecodeString(fmt.Sprint(v)); err == nil {
+				record.SpanId = id
+				continue
+			}
+		}
+		record.Attributes = append(record.Attributes, &commonpb.KeyValue{Key: k, Value: toAnyValue(v)})
+	}
+	if ent.Caller.Defined {
+		record.Attributes = append(record.Attributes, &commonpb.KeyValue{
+			Key:   "code.caller",
+			Value: toAnyValue(ent.Caller.TrimmedPath()),
+		})
+	}
+
+	return record
+}
+
+func toAnyValue(v interface{}) *commonpb.AnyValue {
+	switch val := v.(type) {
+	case string:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: val}}
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: val}}
+	case int:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case int8:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case int16:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case int32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case int64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: val}}
+	case uint:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case uint8:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case uint16:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case uint32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case uint64:
+		if val > math.MaxInt64 {
+			return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: fmt.Sprint(val)}}
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(val)}}
+	case float32:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: float64(val)}}
+	case float64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: val}}
+	case time.Time:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: val.Format(time.RFC3339Nano)}}
+	case time.Duration:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: val.String()}}
+	case []interface{}:
+		values := make([]*commonpb.AnyValue, 0, len(val))
+		for _, item := range val {
+			values = append(values, toAnyValue(item))
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: values}}}
+	case map[string]interface{}:
+		kvs := make([]*commonpb.KeyValue, 0, len(val))
+		for k, item := range val {
+			kvs = append(kvs, &commonpb.KeyValue{Key: k, Value: toAnyValue(item)})
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: kvs}}}
+	default:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: fmt.Sprint(val)}}
+	}
+}
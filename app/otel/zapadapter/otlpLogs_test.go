@@ -0,0 +1,77 @@
+package zap
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/sdk/resource"
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestToLogRecord(t *testing.T) {
+	ent := zapcore.Entry{Level: zapcore.WarnLevel, Time: time.Unix(10, 0), Message: "Updated user with id"}
+	record := toLogRecord(ent, []zapcore.Field{
+		zap.Int("uid", 7),
+		zap.String(traceIdField, "4bf92f3577b34da6a3ce929d0e0e4736"),
+		zap.String(spanIdField, "00f067aa0ba902b7"),
+	})
+
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_WARN, record.SeverityNumber)
+	assert.Equal(t, "Updated user with id", record.Body.GetStringValue())
+	assert.Equal(t, uint64(10*time.Second), record.TimeUnixNano)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", hex.EncodeToString(record.TraceId))
+	assert.Equal(t, "00f067aa0ba902b7", hex.EncodeToString(record.SpanId))
+	assert.Len(t, record.Attributes, 1)
+	assert.Equal(t, "uid", record.Attributes[0].Key)
+	assert.Equal(t, int64(7), record.Attributes[0].Value.GetIntValue())
+}
+
+func TestOtlpLogExporterDropsWhenFull(t *testing.T) {
+	e := &otlpLogExporter{queue: make(chan *logspb.LogRecord, 1)}
+	e.enqueue(&logspb.LogRecord{})
+	e.enqueue(&logspb.LogRecord{})
+	e.enqueue(&logspb.LogRecord{})
+
+	assert.Len(t, e.queue, 1)
+	assert.Equal(t, int64(2), e.dropped.Load())
+}
+
+// recordingLogsClient keeps the exported records in memory
+type recordingLogsClient struct {
+	records []*logspb.LogRecord
+	closed  bool
+}
+
+func (c *recordingLogsClient) Export(_ context.Context, req *collogspb.ExportLogsServiceRequest) error {
+	c.records = append(c.records, req.ResourceLogs[0].ScopeLogs[0].LogRecords...)
+	return nil
+}
+
+func (c *recordingLogsClient) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestOtlpLogExporterShutdown(t *testing.T) {
+	client := &recordingLogsClient{}
+	e, err := newOtlpLogExporter(client, resource.Empty(), 10, 10, time.Hour)
+	assert.NoError(t, err)
+
+	e.enqueue(&logspb.LogRecord{})
+	e.enqueue(&logspb.LogRecord{})
+	assert.NoError(t, e.shutdown(context.Background()))
+
+	// The queued records are exported before the client is closed
+	assert.Len(t, client.records, 2)
+	assert.True(t, client.closed)
+
+	// Flushing and shutting down again don't block once the loop is stopped
+	assert.NoError(t, e.flush(context.Background()))
+	assert.NoError(t, e.shutdown(context.Background()))
+}
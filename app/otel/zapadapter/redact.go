@@ -0,0 +1,237 @@
+package zap
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const redactedValue = "[REDACTED]"
+
+// redactor removes personal data before it reaches the log output or the
+// spans, fields are replaced entirely when their name matches a rule and
+// string values are scrubbed with the patterns
+type redactor struct {
+	fields   map[string]struct{}
+	patterns []*regexp.Regexp
+	hashKey  []byte
+	hash     bool
+}
+
+func newRedactor(fields, patterns []string, mode, hashKey string) (*redactor, error) {
+	r := &redactor{
+		fields:  make(map[string]struct{}, len(fields)),
+		hashKey: []byte(hashKey),
+	}
+
+	switch mode {
+	case "mask":
+	case "hash":
+		if hashKey == "" {
+			return nil, fmt.Errorf("Log redact mode hash requires a hash key")
+		}
+		r.hash = true
+	default:
+		return nil, fmt.Errorf("Unknown log redact mode %q, expected mask or hash", mode)
+	}
+
+	for _, f := range fields {
+		if f = strings.TrimSpace(f); f != "" {
+			r.fields[strings.ToLower(f)] = struct{}{}
+		}
+	}
+	for _, p := range patterns {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid log redact pattern %q: %w", p, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+
+	return r, nil
+}
+
+// conceal masks the value or, in hash mode, replaces it with a keyed hash so
+// the same value can still be correlated across log lines
+func (r *redactor) conceal(value string) string {
+	if !r.hash {
+		return redactedValue
+	}
+	mac := hmac.New(sha256.New, r.hashKey)
+	mac.Write([]byte(value))
+	return "sha256:" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+func (r *redactor) sensitive(key string) bool {
+	// The baggage entries are matched by their name without the prefix
+	_, ok := r.fields[strings.ToLower(strings.TrimPrefix(key, baggagePrefix))]
+	return ok
+}
+
+// scrub replaces the parts of the value matching any of the patterns
+func (r *redactor) scrub(value string) string {
+	for _, re := range r.patterns {
+		value = re.ReplaceAllStringFunc(value, r.conceal)
+	}
+	return value
+}
+
+func (r *redactor) message(msg string) string {
+	if r == nil {
+		return msg
+	}
+	return r.scrub(msg)
+}
+
+func (r *redactor) field(f zapcore.Field) zapcore.Field {
+	if f.Type != zapcore.InlineMarshalerType && r.sensitive(f.Key) {
+		return zap.String(f.Key, r.conceal(fieldValue(f)))
+	}
+
+	switch f.Type {
+	case zapcore.ObjectMarshalerType, zapcore.ArrayMarshalerType, zapcore.ReflectType:
+		// Flattened to maps and slices so the nested keys and strings are
+		// redacted too, left as is when nothing is
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+		if value, changed := r.value(enc.Fields[f.Key]); changed {
+			return zap.Any(f.Key, value)
+		}
+		return f
+	case zapcore.InlineMarshalerType:
+		enc := zapcore.NewMapObjectEncoder()
+		f.AddTo(enc)
+		if value, changed := r.value(enc.Fields); changed {
+			return zap.Inline(inlineFields(value.(map[string]interface{})))
+		}
+		return f
+	}
+	if len(r.patterns) == 0 {
+		return f
+	}
+
+	switch f.Type {
+	case zapcore.StringType:
+		return zap.String(f.Key, r.scrub(f.String))
+	case zapcore.ByteStringType:
+		return zap.String(f.Key, r.scrub(string(f.Interface.([]byte))))
+	case zapcore.StringerType:
+		return zap.String(f.Key, r.scrub(fieldValue(f)))
+	case zapcore.ErrorType:
+		if err, ok := f.Interface.(error); ok {
+			if msg := err.Error(); r.scrub(msg) != msg {
+				return zap.Error(errors.New(r.scrub(msg)))
+			}
+		}
+	}
+	return f
+}
+
+// value redacts the nested values of an object or an array as flattened by
+// zapcore.MapObjectEncoder, the reflected ones are flattened through their json
+func (r *redactor) value(v interface{}) (interface{}, bool) {
+	switch val := v.(type) {
+	case nil, bool, json.Number, time.Time, time.Duration:
+		return v, false
+	case string:
+		scrubbed := r.scrub(val)
+		return scrubbed, scrubbed != val
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(val))
+		changed := false
+		for k, nested := range val {
+			if r.sensitive(k) {
+				redacted[k] = r.conceal(fmt.Sprint(nested))
+				changed = true
+				continue
+			}
+			var c bool
+			redacted[k], c = r.value(nested)
+			changed = changed || c
+		}
+		return redacted, changed
+	case []interface{}:
+		redacted := make([]interface{}, len(val))
+		changed := false
+		for i, nested := range val {
+			var c bool
+			redacted[i], c = r.value(nested)
+			changed = changed || c
+		}
+		return redacted, changed
+	}
+
+	switch reflect.Indirect(reflect.ValueOf(v)).Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array, reflect.Struct, reflect.Interface:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return v, false
+		}
+		var flat interface{}
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		if err := dec.Decode(&flat); err != nil {
+			return v, false
+		}
+		if redacted, changed := r.value(flat); changed {
+			return redacted, true
+		}
+	}
+	return v, false
+}
+
+// inlineFields adds the redacted fields of an inlined object back to the line
+type inlineFields map[string]interface{}
+
+func (f inlineFields) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	for k, v := range f {
+		zap.Any(k, v).AddTo(enc)
+	}
+	return nil
+}
+
+func (r *redactor) redactFields(fields []zapcore.Field) []zapcore.Field {
+	if r == nil || len(fields) == 0 {
+		return fields
+	}
+	redacted := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		redacted[i] = r.field(f)
+	}
+	return redacted
+}
+
+func (r *redactor) attribute(kv attribute.KeyValue) attribute.KeyValue {
+	if r == nil {
+		return kv
+	}
+	if r.sensitive(string(kv.Key)) {
+		return kv.Key.String(r.conceal(kv.Value.Emit()))
+	}
+	if kv.Value.Type() == attribute.STRING {
+		return kv.Key.String(r.scrub(kv.Value.AsString()))
+	}
+	return kv
+}
+
+// fieldValue renders the value of a field, used as the input of the hash
+func fieldValue(f zapcore.Field) string {
+	enc := zapcore.NewMapObjectEncoder()
+	f.AddTo(enc)
+	return fmt.Sprint(enc.Fields[f.Key])
+}
@@ -0,0 +1,146 @@
+package zap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const emailPattern = `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`
+
+func newBufferedLogger(t *testing.T, mode string) (*ZapLogger, *bytes.Buffer) {
+	redact, err := newRedactor([]string{"user-name", "Password"}, []string{emailPattern}, mode, "secret")
+	assert.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	level := zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(buf), level)
+	return &ZapLogger{adapter: zap.New(core), level: level, redact: redact, spanEvents: true}, buf
+}
+
+func TestRedactNamesNeverReachOutput(t *testing.T) {
+	l, buf := newBufferedLogger(t, "mask")
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, span := tp.Tracer("test").Start(context.Background(), "CreateUserHandler")
+
+	l.Info(ctx, "Created user with name", zap.String("user-name", "Alice Liddell"))
+	l.Error(ctx, "Error creating user with id", zap.ByteString("User-Name", []byte("Alice Liddell")))
+	l.Warn(ctx, "Invite sent to alice@example.com", zap.Error(errors.New("bounced alice@example.com")))
+	l.Debug(ctx, "Login", zap.Int("password", 1234), zap.String("contact", "mail alice@example.com"))
+	span.End()
+
+	out := buf.String()
+	assert.NotContains(t, out, "Alice")
+	assert.NotContains(t, out, "alice@example.com")
+	assert.NotContains(t, out, "1234")
+	assert.Contains(t, out, `"user-name":"[REDACTED]"`)
+	assert.Contains(t, out, `"msg":"Invite sent to [REDACTED]"`)
+
+	events := recorder.Ended()[0].Events()
+	assert.Len(t, events, 4)
+	for _, e := range events {
+		for _, kv := range e.Attributes {
+			assert.NotContains(t, kv.Value.Emit(), "Alice")
+			assert.NotContains(t, kv.Value.Emit(), "alice@example.com")
+			assert.NotContains(t, kv.Value.Emit(), "1234")
+		}
+	}
+}
+
+func TestRedactHash(t *testing.T) {
+	l, buf := newBufferedLogger(t, "hash")
+
+	l.Info(context.Background(), "Created user with name", zap.String("user-name", "Alice Liddell"))
+	l.Info(context.Background(), "Created user with name", zap.String("user-name", "Alice Liddell"))
+
+	out := buf.String()
+	assert.NotContains(t, out, "Alice")
+	hashed := `"user-name":"` + l.redact.conceal("Alice Liddell") + `"`
+	assert.Equal(t, 2, bytes.Count(buf.Bytes(), []byte(hashed)))
+	assert.Contains(t, hashed, "sha256:")
+}
+
+func TestRedactBaggage(t *testing.T) {
+	l, buf := newBufferedLogger(t, "mask")
+	name, _ := baggage.NewMember("user-name", "Alice")
+	contact, _ := baggage.NewMember("contact", "alice@example.com")
+	bag, _ := baggage.New(name, contact)
+
+	l.Info(baggage.ContextWithBaggage(context.Background(), bag), "Listed users")
+
+	out := buf.String()
+	assert.NotContains(t, out, "Alice")
+	assert.NotContains(t, out, "alice@example.com")
+	assert.Contains(t, out, `"baggage.user-name":"[REDACTED]"`)
+	assert.Contains(t, out, `"baggage.contact":"[REDACTED]"`)
+}
+
+type testUser struct {
+	Name  string `json:"user-name"`
+	Email string `json:"email"`
+	Age   int    `json:"age"`
+}
+
+func (u testUser) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("user-name", u.Name)
+	enc.AddString("email", u.Email)
+	enc.AddInt("age", u.Age)
+	return nil
+}
+
+func TestRedactNested(t *testing.T) {
+	l, buf := newBufferedLogger(t, "mask")
+	user := testUser{Name: "Alice Liddell", Email: "alice@example.com", Age: 7}
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, span := tp.Tracer("test").Start(context.Background(), "CreateUserHandler")
+
+	l.Info(ctx, "Created user",
+		zap.Object("user", user),
+		zap.Any("reflected", struct{ User testUser }{user}),
+		zap.Strings("names", []string{"alice@example.com", "bob"}),
+		zap.Reflect("contacts", map[string][]string{"mail": {"alice@example.com"}}),
+		zap.Inline(user),
+	)
+	span.End()
+
+	out := buf.String()
+	assert.NotContains(t, out, "Alice")
+	assert.NotContains(t, out, "alice@example.com")
+	assert.Contains(t, out, `"user":{"age":7,"email":"[REDACTED]","user-name":"[REDACTED]"}`)
+	assert.Contains(t, out, `"names":["[REDACTED]","bob"]`)
+	assert.Contains(t, out, `"contacts":{"mail":["[REDACTED]"]}`)
+	assert.Contains(t, out, `"age":7`)
+
+	for _, kv := range recorder.Ended()[0].Events()[0].Attributes {
+		assert.NotContains(t, kv.Value.Emit(), "Alice")
+		assert.NotContains(t, kv.Value.Emit(), "alice@example.com")
+	}
+}
+
+func TestRedactNestedUnchanged(t *testing.T) {
+	l, buf := newBufferedLogger(t, "mask")
+
+	l.Info(context.Background(), "Listed users", zap.Strings("ids", []string{"1", "2"}))
+	assert.Contains(t, buf.String(), `"ids":["1","2"]`)
+}
+
+func TestNewRedactorInvalid(t *testing.T) {
+	_, err := newRedactor(nil, nil, "drop", "")
+	assert.Error(t, err)
+
+	_, err = newRedactor(nil, nil, "hash", "")
+	assert.Error(t, err)
+
+	_, err = newRedactor(nil, []string{"("}, "mask", "")
+	assert.Error(t, err)
+}
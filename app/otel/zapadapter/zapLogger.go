@@ -2,62 +2,273 @@ package zap
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"prom/app/config"
+	appotel "prom/app/otel"
+	"prom/core/domain/logger"
+	"prom/core/domain/tenancy"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
 	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
 
-func NewZapLogger() (*ZapLogger, error) {
+func NewZapLogger(conf *config.AppConfig) (*ZapLogger, error) {
+	level, err := zap.ParseAtomicLevel(conf.LogLevel)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid log level: %w", err)
+	}
+
 	cfg := zap.NewProductionConfig()
 	// This will log all rows even when CPU is throtling see https://pkg.go.dev/go.uber.org/zap#SamplingConfig
 	cfg.Sampling = nil
+	cfg.Level = level
+	cfg.DisableCaller = !conf.LogCaller
+	// Set below with the configured level
+	cfg.DisableStacktrace = true
+
+	switch conf.LogEncoding {
+	case "json":
+	case "console":
+		cfg.Encoding = "console"
+		cfg.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	default:
+		return nil, fmt.Errorf("Unknown log encoding %q, expected json or console", conf.LogEncoding)
+	}
+
+	// Skip the ZapLogger frames so the caller is the one using the logger.Logger
+	opts := []zap.Option{zap.AddCallerSkip(2)}
+	if conf.LogStacktraceLevel != "none" {
+		stackLevel, err := zapcore.ParseLevel(conf.LogStacktraceLevel)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid log stacktrace level: %w", err)
+		}
+		opts = append(opts, zap.AddStacktrace(stackLevel))
+	}
+
+	adapter, err := cfg.Build(opts...)
+
+	if err != nil {
+		return nil, err
+	}
 
-	adapter, err := cfg.Build()
+	res, err := appotel.NewResource(context.Background(), conf)
+	if err != nil {
+		return nil, err
+	}
+
+	names, err := appotel.ExporterNames("log", conf.LogExporters)
+	if err != nil {
+		return nil, err
+	}
+
+	var cores []zapcore.Core
+	var exporters []*otlpLogExporter
+	for _, name := range names {
+		switch name {
+		case "stdout":
+			cores = append(cores, adapter.Core())
+		case "otlp", "otlphttp":
+			var client logsClient
+			if name == "otlp" {
+				client, err = newGrpcLogsClient(conf.OTELCollectorURL)
+			} else {
+				client, err = newHttpLogsClient(conf)
+			}
+			if err != nil {
+				return nil, err
+			}
+			exporter, err := newOtlpLogExporter(
+				client,
+				res,
+				conf.LogExportQueueSize,
+				conf.LogExportBatchSize,
+				conf.LogExportInterval,
+			)
+			if err != nil {
+				return nil, err
+			}
+			exporters = append(exporters, exporter)
+			cores = append(cores, newOtlpCore(level, exporter))
+		case "file":
+			w, err := appotel.NewFileWriter(conf, "logs")
+			if err != nil {
+				return nil, err
+			}
+			// Always json lines whatever the encoding of stdout
+			enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+			cores = append(cores, zapcore.NewCore(enc, zapcore.AddSync(w), level))
+		case "span_events", "none":
+		default:
+			return nil, fmt.Errorf("Unknown log exporter %q", name)
+		}
+	}
+	adapter = adapter.WithOptions(zap.WrapCore(func(zapcore.Core) zapcore.Core {
+		return zapcore.NewTee(cores...)
+	}))
 
+	redact, err := newRedactor(conf.LogRedactFields, conf.LogRedactPatterns, conf.LogRedactMode, conf.LogRedactHashKey)
 	if err != nil {
 		return nil, err
 	}
 
+	// Static fields added to every line of every core
+	adapter = adapter.With(
+		zap.String("service", conf.ServiceName),
+		zap.String("version", conf.ServiceVersion),
+		zap.String("env", conf.Environment),
+	)
+
 	return &ZapLogger{
-		adapter: adapter,
+		adapter:    adapter,
+		level:      level,
+		redact:     redact,
+		spanEvents: conf.LogExporterEnabled("span_events"),
+		exporters:  exporters,
 	}, nil
 }
 
 type ZapLogger struct {
-	adapter *zap.Logger
+	adapter    *zap.Logger
+	level      zap.AtomicLevel
+	redact     *redactor
+	spanEvents bool
+	exporters  []*otlpLogExporter
+}
+
+// LevelHandler serves the level of the logger, GET returns it and PUT with
+// {"level":"debug"} changes it at runtime
+func (l *ZapLogger) LevelHandler() http.Handler {
+	return l.level
 }
 
-func getTracingInfo(ctx context.Context) (*zap.Field, *zap.Field) {
+// getTracingInfo is empty when there is no active span, e.g. during the startup
+func getTracingInfo(ctx context.Context) []zap.Field {
 	spanCtx := trace.SpanFromContext(ctx).SpanContext()
 	if spanCtx.HasSpanID() && spanCtx.HasTraceID() {
-    trid := zap.String("trace-id", spanCtx.TraceID().String())
-    spid :=  zap.String("span-id", spanCtx.SpanID().String())
-		return &trid, &spid
+		return []zap.Field{
+			zap.String(traceIdField, spanCtx.TraceID().String()),
+			zap.String(spanIdField, spanCtx.SpanID().String()),
+		}
 	}
-	return nil, nil
+	return nil
 }
 
-func (l *ZapLogger) Info(ctx context.Context, msg string,  args ...zapcore.Field) {
-	traceId, spanId := getTracingInfo(ctx)
-	l.adapter.Info(msg, append(args, *traceId, *spanId)...)
+// getBaggageFields exposes the propagated baggage entries as "baggage.<key>" fields
+func getBaggageFields(ctx context.Context) []zap.Field {
+	members := baggage.FromContext(ctx).Members()
+	if len(members) == 0 {
+		return nil
+	}
+	fields := make([]zap.Field, 0, len(members))
+	for _, m := range members {
+		fields = append(fields, zap.String(baggagePrefix+m.Key(), m.Value()))
+	}
+	return fields
+}
+
+// addSpanEvent records the log line as an event of the active span
+func (l *ZapLogger) addSpanEvent(ctx context.Context, level zapcore.Level, msg string, fields []zapcore.Field) {
+	if !l.spanEvents {
+		return
+	}
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	attrs := make([]attribute.KeyValue, 0, len(enc.Fields)+2)
+	attrs = append(attrs,
+		attribute.String("log.severity", level.CapitalString()),
+		attribute.String("log.message", msg),
+	)
+	for k, v := range enc.Fields {
+		attrs = append(attrs, l.redact.attribute(toAttribute(k, v)))
+	}
+	span.AddEvent("log", trace.WithAttributes(attrs...))
+}
+
+func toAttribute(k string, v interface{}) attribute.KeyValue {
+	switch val := v.(type) {
+	case string:
+		return attribute.String(k, val)
+	case bool:
+		return attribute.Bool(k, val)
+	case int:
+		return attribute.Int(k, val)
+	case int64:
+		return attribute.Int64(k, val)
+	case float64:
+		return attribute.Float64(k, val)
+	default:
+		return attribute.String(k, fmt.Sprint(val))
+	}
+}
+
+func (l *ZapLogger) log(ctx context.Context, level zapcore.Level, msg string, fields []zapcore.Field) {
+	if !l.level.Enabled(level) {
+		return
+	}
+	// nil when no core is configured, e.g. with the span_events exporter alone,
+	// the span event is recorded all the same
+	ce := l.adapter.Check(level, msg)
+	if ce == nil && !l.spanEvents {
+		return
+	}
+	fields = append(fields, getTracingInfo(ctx)...)
+	if id := logger.RequestID(ctx); id != "" {
+		fields = append(fields, zap.String(requestIdField, id))
+	}
+	if id := tenancy.Tenant(ctx); id != "" {
+		fields = append(fields, zap.String(tenantIdField, id))
+	}
+	fields = append(fields, getBaggageFields(ctx)...)
+	// Redacted once every field is added and before anything is written, neither
+	// the cores nor the span see the raw values, baggage entries included
+	msg = l.redact.message(msg)
+	fields = l.redact.redactFields(fields)
+	l.addSpanEvent(ctx, level, msg, fields)
+	if ce != nil {
+		ce.Message = msg
+		ce.Write(fields...)
+	}
+}
+
+func (l *ZapLogger) Info(ctx context.Context, msg string, args ...zapcore.Field) {
+	l.log(ctx, zapcore.InfoLevel, msg, args)
 }
 
 func (l *ZapLogger) Warn(ctx context.Context, msg string, args ...zapcore.Field) {
-	traceId, spanId := getTracingInfo(ctx)
-	l.adapter.Warn(msg, append(args, *traceId, *spanId)...)
+	l.log(ctx, zapcore.WarnLevel, msg, args)
 }
 
 func (l *ZapLogger) Error(ctx context.Context, msg string, args ...zapcore.Field) {
-	traceId, spanId := getTracingInfo(ctx)
-	l.adapter.Error(msg, append(args, *traceId, *spanId)...)
+	l.log(ctx, zapcore.ErrorLevel, msg, args)
 }
 
 func (l *ZapLogger) Debug(ctx context.Context, msg string, args ...zapcore.Field) {
-	traceId, spanId := getTracingInfo(ctx)
-	l.adapter.Debug(msg, append(args, *traceId, *spanId)...)
+	l.log(ctx, zapcore.DebugLevel, msg, args)
 }
 
 func (l *ZapLogger) Sync() error {
 	return l.adapter.Sync()
 }
+
+// Shutdown flushes the logs and stops the otlp exporters, nothing is shipped
+// to the collector once it returns
+func (l *ZapLogger) Shutdown(ctx context.Context) error {
+	err := l.adapter.Sync()
+	for _, e := range l.exporters {
+		if shutdownErr := e.shutdown(ctx); shutdownErr != nil && err == nil {
+			err = fmt.Errorf("Cannot shutdown the log exporter: %w", shutdownErr)
+		}
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package zap
+
+import (
+	"context"
+	"prom/app/config"
+	"prom/core/domain/logger"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func newObservedLogger() (*ZapLogger, *observer.ObservedLogs) {
+	level := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	core, logs := observer.New(level)
+	return &ZapLogger{adapter: zap.New(core), level: level}, logs
+}
+
+func TestZapLoggerWithoutSpan(t *testing.T) {
+	l, logs := newObservedLogger()
+
+	assert.NotPanics(t, func() { l.Info(context.Background(), "Starting", zap.Int("port", 3000)) })
+	assert.Equal(t, 1, logs.Len())
+	assert.Equal(t, map[string]interface{}{"port": int64(3000)}, logs.All()[0].ContextMap())
+}
+
+func TestZapLoggerWithSpan(t *testing.T) {
+	l, logs := newObservedLogger()
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{0x4b, 0xf9},
+		SpanID:  trace.SpanID{0x00, 0xf0},
+	}))
+
+	l.Warn(ctx, "Updated user")
+	fields := logs.All()[0].ContextMap()
+	assert.Equal(t, "4bf90000000000000000000000000000", fields[traceIdField])
+	assert.Equal(t, "00f0000000000000", fields[spanIdField])
+}
+
+func TestZapLoggerLevel(t *testing.T) {
+	l, logs := newObservedLogger()
+
+	l.Debug(context.Background(), "Hidden")
+	l.level.SetLevel(zapcore.DebugLevel)
+	l.Debug(context.Background(), "Shown")
+
+	assert.Equal(t, 1, logs.Len())
+	assert.Equal(t, "Shown", logs.All()[0].Message)
+}
+
+func TestZapLoggerRequestID(t *testing.T) {
+	l, logs := newObservedLogger()
+
+	l.Info(logger.WithRequestID(context.Background(), "req-1"), "Listed Users")
+	assert.Equal(t, "req-1", logs.All()[0].ContextMap()[requestIdField])
+}
+
+func TestZapLoggerSpanEventsOnly(t *testing.T) {
+	l, err := NewZapLogger(&config.AppConfig{
+		ServiceName:        "ms-baselines-golang",
+		LogLevel:           "info",
+		LogEncoding:        "json",
+		LogStacktraceLevel: "none",
+		LogRedactMode:      "mask",
+		LogExporters:       []string{"span_events"},
+	})
+	assert.NoError(t, err)
+
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, span := tp.Tracer("test").Start(context.Background(), "ListUsersHandler")
+	l.Info(ctx, "Listed Users", zap.Int("count", 2))
+	l.Debug(ctx, "Hidden")
+	span.End()
+
+	events := recorder.Ended()[0].Events()
+	assert.Len(t, events, 1)
+	assert.Contains(t, events[0].Attributes, attribute.String("log.message", "Listed Users"))
+	assert.Contains(t, events[0].Attributes, attribute.Int64("count", 2))
+}
@@ -0,0 +1,149 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests per Window
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+// ParseLimit reads a limit written as requests/window, e.g. 10/1m
+func ParseLimit(s string) (Limit, error) {
+	requests, window, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("Invalid limit %q, expected requests/window", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n <= 0 {
+		return Limit{}, fmt.Errorf("Invalid number of requests in limit %q", s)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("Invalid window in limit %q", s)
+	}
+	return Limit{Requests: n, Window: d}, nil
+}
+
+// Policy is the value of the RateLimit-Policy header
+func (l Limit) Policy() string {
+	return fmt.Sprintf("%d;w=%d", l.Requests, int(math.Ceil(l.Window.Seconds())))
+}
+
+// State is what the stores keep per key, its meaning depends on the algorithm
+type State struct {
+	Value float64
+	Prev  float64
+	Stamp time.Time
+}
+
+// Result is the decision for one request and the values of the RateLimit headers
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Algorithm takes one request from the state of a key, it is a pure function
+// so the stores only have to apply it atomically
+type Algorithm interface {
+	Take(s State, l Limit, now time.Time) (State, Result)
+	// TTL is how long the state of an idle key is still needed by Take
+	TTL(l Limit) time.Duration
+}
+
+func NewAlgorithm(name string) (Algorithm, error) {
+	switch name {
+	case "token_bucket":
+		return tokenBucket{}, nil
+	case "sliding_window":
+		return slidingWindow{}, nil
+	default:
+		return nil, fmt.Errorf("Unknown rate limit algorithm %q", name)
+	}
+}
+
+// tokenBucket refills Requests tokens per Window up to Requests, Value is the
+// number of tokens and Stamp the last refill. Allows bursts of Requests
+type tokenBucket struct{}
+
+func (tokenBucket) Take(s State, l Limit, now time.Time) (State, Result) {
+	capacity := float64(l.Requests)
+	rate := capacity / l.Window.Seconds()
+
+	tokens := capacity
+	if !s.Stamp.IsZero() {
+		tokens = math.Min(capacity, s.Value+now.Sub(s.Stamp).Seconds()*rate)
+	}
+
+	res := Result{Limit: l.Requests}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - tokens) / rate)
+	}
+	res.Remaining = int(tokens)
+	res.Reset = seconds((capacity - tokens) / rate)
+
+	return State{Value: tokens, Stamp: now}, res
+}
+
+// TTL is the time to refill an empty bucket
+func (tokenBucket) TTL(l Limit) time.Duration {
+	return l.Window
+}
+
+// slidingWindow weights the count of the previous window by how much of it is
+// still in the sliding window, Value and Prev are the counts of the current and
+// previous windows and Stamp the start of the current one
+type slidingWindow struct{}
+
+func (slidingWindow) Take(s State, l Limit, now time.Time) (State, Result) {
+	start := now.Truncate(l.Window)
+	current, prev := s.Value, s.Prev
+	if !s.Stamp.Equal(start) {
+		prev = 0
+		if s.Stamp.Equal(start.Add(-l.Window)) {
+			prev = s.Value
+		}
+		current = 0
+	}
+
+	elapsed := float64(now.Sub(start)) / float64(l.Window)
+	estimate := prev*(1-elapsed) + current
+	limit := float64(l.Requests)
+	windowEnd := start.Add(l.Window).Sub(now)
+
+	res := Result{Limit: l.Requests, Reset: windowEnd}
+	if estimate+1 <= limit {
+		current++
+		res.Allowed = true
+		res.Remaining = int(limit - estimate - 1)
+	} else if prev > 0 && current+1 <= limit {
+		// Once enough of the previous window has slid out
+		at := 1 - (limit-1-current)/prev
+		res.RetryAfter = time.Duration(at*float64(l.Window)) - now.Sub(start)
+	} else {
+		res.RetryAfter = windowEnd
+	}
+
+	return State{Value: current, Prev: prev, Stamp: start}, res
+}
+
+// TTL keeps the count of the current window while it is the previous one
+func (slidingWindow) TTL(l Limit) time.Duration {
+	return 2 * l.Window
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,126 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"prom/app/db"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func TestParseLimit(t *testing.T) {
+	l, err := ParseLimit("10/1m")
+	assert.NoError(t, err)
+	assert.Equal(t, Limit{Requests: 10, Window: time.Minute}, l)
+	assert.Equal(t, "10;w=60", l.Policy())
+
+	for _, invalid := range []string{"10", "0/1m", "x/1m", "10/x", "10/-1s"} {
+		_, err := ParseLimit(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	l := Limit{Requests: 2, Window: 2 * time.Second}
+	now := time.Now()
+	s := State{}
+
+	var res Result
+	s, res = tokenBucket{}.Take(s, l, now)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 1, res.Remaining)
+	s, res = tokenBucket{}.Take(s, l, now)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	s, res = tokenBucket{}.Take(s, l, now)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, time.Second, res.RetryAfter)
+
+	// One token per second
+	_, res = tokenBucket{}.Take(s, l, now.Add(time.Second))
+	assert.True(t, res.Allowed)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	l := Limit{Requests: 2, Window: time.Minute}
+	start := time.Now().Truncate(time.Minute)
+	s := State{}
+
+	var res Result
+	s, res = slidingWindow{}.Take(s, l, start)
+	assert.True(t, res.Allowed)
+	s, res = slidingWindow{}.Take(s, l, start.Add(time.Second))
+	assert.True(t, res.Allowed)
+	s, res = slidingWindow{}.Take(s, l, start.Add(2*time.Second))
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 58*time.Second, res.RetryAfter)
+
+	// Half of the previous window still counts, 2 * 0.5 + 0 leaves one request
+	s, res = slidingWindow{}.Take(s, l, start.Add(90*time.Second))
+	assert.True(t, res.Allowed)
+	_, res = slidingWindow{}.Take(s, l, start.Add(91*time.Second))
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 29*time.Second, res.RetryAfter)
+
+	// The count of a window is still weighted during the next one
+	assert.Equal(t, 2*time.Minute, slidingWindow{}.TTL(l))
+}
+
+func testStore(t *testing.T, store Store) {
+	l := Limit{Requests: 5, Window: time.Minute}
+	allowed := 0
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := store.Update(context.Background(), "client", time.Minute, func(s State) State {
+				s, res := tokenBucket{}.Take(s, l, time.Now())
+				if res.Allowed {
+					mu.Lock()
+					allowed++
+					mu.Unlock()
+				}
+				return s
+			})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 5, allowed)
+
+	// Peek reads the state left by the updates without taking a request
+	for i := 0; i < 2; i++ {
+		s, err := store.Peek(context.Background(), "client")
+		assert.NoError(t, err)
+		assert.False(t, s.Stamp.IsZero())
+		_, res := tokenBucket{}.Take(s, l, time.Now())
+		assert.False(t, res.Allowed)
+	}
+	s, err := store.Peek(context.Background(), "unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, State{}, s)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestMySQLStore(t *testing.T) {
+	conn, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{Logger: logger.Discard})
+	assert.NoError(t, err)
+	assert.NoError(t, conn.AutoMigrate(&db.RateLimitBucket{}))
+	// sqlite has no row locks, a single connection serializes the transactions
+	sqlDB, err := conn.DB()
+	assert.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	testStore(t, NewMySQLStore(conn))
+}
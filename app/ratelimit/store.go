@@ -0,0 +1,141 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"prom/app/db"
+	"prom/core/domain/repository"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// cleanupInterval is how often the expired states are removed
+const cleanupInterval = time.Minute
+
+// Store keeps the state of every key, Update applies fn atomically and the
+// state is forgotten once unused for ttl. Peek reads the state without locking
+// it, the zero state when it is unknown or forgotten
+type Store interface {
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(State) State) error
+	Peek(ctx context.Context, key string) (State, error)
+}
+
+type memoryEntry struct {
+	state   State
+	expires time.Time
+}
+
+// MemoryStore is local to the replica, each replica enforces the limits alone
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+	cleaned time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: map[string]memoryEntry{}, cleaned: time.Now()}
+}
+
+func (s *MemoryStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(State) State) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(s.cleaned) > cleanupInterval {
+		for k, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, k)
+			}
+		}
+		s.cleaned = now
+	}
+
+	e, ok := s.entries[key]
+	if !ok || now.After(e.expires) {
+		e = memoryEntry{}
+	}
+	s.entries[key] = memoryEntry{state: fn(e.state), expires: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Peek(ctx context.Context, key string) (State, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok || time.Now().After(e.expires) {
+		return State{}, nil
+	}
+	return e.state, nil
+}
+
+// MySQLStore shares the limits between the replicas, the row of the key is
+// locked while the algorithm runs
+type MySQLStore struct {
+	conn    repository.Connection
+	cleaned atomic.Int64
+}
+
+func NewMySQLStore(conn repository.Connection) *MySQLStore {
+	s := &MySQLStore{conn: conn}
+	s.cleaned.Store(time.Now().UnixNano())
+	return s
+}
+
+func (s *MySQLStore) Update(ctx context.Context, key string, ttl time.Duration, fn func(State) State) error {
+	now := time.Now()
+	err := s.conn.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// The row exists before being locked so concurrent first requests serialize too
+		insert := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&db.RateLimitBucket{
+			Bucket:    key,
+			ExpiresAt: now.Add(ttl),
+		})
+		if insert.Error != nil {
+			return insert.Error
+		}
+
+		bucket := &db.RateLimitBucket{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("bucket = ?", key).First(bucket).Error; err != nil {
+			return err
+		}
+
+		state := State{}
+		if bucket.StampNano != 0 && now.Before(bucket.ExpiresAt) {
+			state = State{Value: bucket.Value, Prev: bucket.Prev, Stamp: time.Unix(0, bucket.StampNano)}
+		}
+		state = fn(state)
+
+		return tx.Model(bucket).Where("bucket = ?", key).Updates(map[string]interface{}{
+			"value":      state.Value,
+			"prev":       state.Prev,
+			"stamp_nano": state.Stamp.UnixNano(),
+			"expires_at": now.Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("Cannot update rate limit of %s: %w", key, err)
+	}
+
+	if last := s.cleaned.Load(); now.UnixNano()-last > int64(cleanupInterval) && s.cleaned.CompareAndSwap(last, now.UnixNano()) {
+		if err := s.conn.WithContext(ctx).Where("expires_at < ?", now).Delete(&db.RateLimitBucket{}).Error; err != nil {
+			return fmt.Errorf("Cannot delete the expired rate limits: %w", err)
+		}
+	}
+	return nil
+}
+
+func (s *MySQLStore) Peek(ctx context.Context, key string) (State, error) {
+	bucket := &db.RateLimitBucket{}
+	tx := s.conn.WithContext(ctx).Where("bucket = ? AND expires_at > ?", key, time.Now()).Limit(1).Find(bucket)
+	if tx.Error != nil {
+		return State{}, fmt.Errorf("Cannot get rate limit of %s: %w", key, tx.Error)
+	}
+	if tx.RowsAffected == 0 || bucket.StampNano == 0 {
+		return State{}, nil
+	}
+	return State{Value: bucket.Value, Prev: bucket.Prev, Stamp: time.Unix(0, bucket.StampNano)}, nil
+}
@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Action is what a principal is allowed to do, the scopes named after an
+// action grant it directly
+type Action string
+
+const (
+	ActionUserRead   Action = "user:read"
+	ActionUserWrite  Action = "user:write"
+	ActionUserDelete Action = "user:delete"
+	// Grants every action
+	ActionAdmin Action = "admin"
+)
+
+var actions = map[Action]bool{
+	ActionUserRead:   true,
+	ActionUserWrite:  true,
+	ActionUserDelete: true,
+	ActionAdmin:      true,
+}
+
+var (
+	UnauthenticatedError = errors.New("Authentication required")
+	ForbiddenError       = errors.New("Forbidden")
+)
+
+// Policy decides which actions a principal can perform, it is evaluated by
+// the usecases so every entry point enforces the same rules
+type Policy struct {
+	// When disabled every action but admin is allowed to anonymous callers
+	enabled bool
+	roles   map[string]map[Action]bool
+	owner   map[Action]bool
+	// Issuer of the JWTs whose subject is a user id, any issuer when empty
+	ownerIssuer string
+}
+
+// NewPolicy parses the roles as role=action,action and the actions granted to
+// the owner of a resource, only the JWTs of ownerIssuer can own a resource
+func NewPolicy(enabled bool, roles []string, ownerActions []string, ownerIssuer string) (*Policy, error) {
+	p := &Policy{
+		enabled:     enabled,
+		roles:       make(map[string]map[Action]bool, len(roles)),
+		owner:       make(map[Action]bool, len(ownerActions)),
+		ownerIssuer: ownerIssuer,
+	}
+
+	for _, r := range roles {
+		if strings.TrimSpace(r) == "" {
+			continue
+		}
+		role, granted, ok := strings.Cut(r, "=")
+		if !ok {
+			return nil, fmt.Errorf("Invalid role %q, expected role=action,action", r)
+		}
+		role = strings.TrimSpace(role)
+		p.roles[role] = map[Action]bool{}
+		for _, a := range strings.Split(granted, ",") {
+			action, err := parseAction(a)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid role %s: %w", role, err)
+			}
+			p.roles[role][action] = true
+		}
+	}
+
+	for _, a := range ownerActions {
+		action, err := parseAction(a)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid owner action: %w", err)
+		}
+		p.owner[action] = true
+	}
+
+	return p, nil
+}
+
+// ValidScope is true when the scope names an action, the other scopes grant nothing
+func ValidScope(scope string) bool {
+	return actions[Action(scope)]
+}
+
+func parseAction(s string) (Action, error) {
+	action := Action(strings.TrimSpace(s))
+	if !actions[action] {
+		return "", fmt.Errorf("Unknown action %q", s)
+	}
+	return action, nil
+}
+
+// Authorize checks the principal of the context, owner is the subject owning
+// the resource, empty when the resource has no owner
+func (p *Policy) Authorize(ctx context.Context, action Action, owner string) error {
+	if !p.enabled && action != ActionAdmin {
+		return nil
+	}
+
+	principal := PrincipalFrom(ctx)
+	if principal == nil {
+		return UnauthenticatedError
+	}
+	if p.granted(principal, action) {
+		return nil
+	}
+	if p.owns(principal, owner) && p.owner[action] {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is not allowed to %s", ForbiddenError, principal.Subject, action)
+}
+
+// owns is true when the principal is the user owning the resource, the API
+// keys and the tokens of other issuers never own one even with the same subject
+func (p *Policy) owns(principal *Principal, owner string) bool {
+	if owner == "" || owner != principal.Subject || principal.Method != "jwt" {
+		return false
+	}
+	return p.ownerIssuer == "" || principal.Issuer == p.ownerIssuer
+}
+
+func (p *Policy) granted(principal *Principal, action Action) bool {
+	for _, scope := range principal.Scopes {
+		if Action(scope) == action || Action(scope) == ActionAdmin {
+			return true
+		}
+	}
+	for _, role := range principal.Roles {
+		if granted := p.roles[role]; granted[action] || granted[ActionAdmin] {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	p, err := NewPolicy(true, []string{"admin=admin", "viewer=user:read"}, []string{"user:read", "user:write"}, "https://idp.example.com")
+	assert.NoError(t, err)
+
+	anonymous := context.Background()
+	admin := WithPrincipal(anonymous, &Principal{Subject: "1", Roles: []string{"admin"}})
+	viewer := WithPrincipal(anonymous, &Principal{Subject: "2", Issuer: "https://idp.example.com", Method: "jwt", Roles: []string{"viewer"}})
+	service := WithPrincipal(anonymous, &Principal{Subject: "apikey:abc", Scopes: []string{"user:delete"}})
+
+	assert.ErrorIs(t, p.Authorize(anonymous, ActionUserRead, ""), UnauthenticatedError)
+
+	assert.NoError(t, p.Authorize(admin, ActionUserDelete, "7"))
+	assert.NoError(t, p.Authorize(admin, ActionAdmin, ""))
+
+	assert.NoError(t, p.Authorize(viewer, ActionUserRead, "7"))
+	assert.ErrorIs(t, p.Authorize(viewer, ActionUserWrite, "7"), ForbiddenError)
+	// Owners can update themselves but not delete themselves
+	assert.NoError(t, p.Authorize(viewer, ActionUserWrite, "2"))
+	assert.ErrorIs(t, p.Authorize(viewer, ActionUserDelete, "2"), ForbiddenError)
+
+	assert.NoError(t, p.Authorize(service, ActionUserDelete, "7"))
+	assert.ErrorIs(t, p.Authorize(service, ActionAdmin, ""), ForbiddenError)
+}
+
+func TestPolicyOwnership(t *testing.T) {
+	p, err := NewPolicy(true, nil, []string{"user:read"}, "https://idp.example.com")
+	assert.NoError(t, err)
+
+	cases := map[string]struct {
+		principal *Principal
+		owner     bool
+	}{
+		"token of the issuer":     {&Principal{Subject: "5", Issuer: "https://idp.example.com", Method: "jwt"}, true},
+		"token of another issuer": {&Principal{Subject: "5", Issuer: "https://evil.example.com", Method: "jwt"}, false},
+		"api key":                 {&Principal{Subject: "5", Method: "apikey"}, false},
+		"other subject":           {&Principal{Subject: "6", Issuer: "https://idp.example.com", Method: "jwt"}, false},
+	}
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			err := p.Authorize(WithPrincipal(context.Background(), tc.principal), ActionUserRead, "5")
+			if tc.owner {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ForbiddenError)
+			}
+		})
+	}
+}
+
+func TestDisabledPolicy(t *testing.T) {
+	p, err := NewPolicy(false, nil, nil, "")
+	assert.NoError(t, err)
+
+	assert.NoError(t, p.Authorize(context.Background(), ActionUserDelete, "7"))
+	assert.ErrorIs(t, p.Authorize(context.Background(), ActionAdmin, ""), UnauthenticatedError)
+}
+
+func TestNewPolicyInvalid(t *testing.T) {
+	_, err := NewPolicy(true, []string{"admin"}, nil, "")
+	assert.Error(t, err)
+	_, err = NewPolicy(true, []string{"admin=user:destroy"}, nil, "")
+	assert.Error(t, err)
+}
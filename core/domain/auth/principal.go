@@ -0,0 +1,29 @@
+package auth
+
+import "context"
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Subject string
+	Issuer  string
+	// jwt or apikey
+	Method string
+	Roles  []string
+	Scopes []string
+	// Tenant the principal belongs to, empty when the credentials carry none
+	Tenant string
+}
+
+type principalKey struct{}
+
+// WithPrincipal stores the authenticated caller, the usecases read it back
+// with PrincipalFrom
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom returns the caller of the request, nil for anonymous requests
+func PrincipalFrom(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
@@ -0,0 +1,17 @@
+package logger
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID stores the request id, the Logger adds it to every line
+// logged with the returned context
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the id of the request being served, empty outside of a request
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,17 @@
+package tenancy
+
+import "context"
+
+type tenantKey struct{}
+
+// WithTenant stores the tenant of the request, the queries run with the
+// returned context only see the rows of that tenant
+func WithTenant(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// Tenant returns the tenant of the request, empty when it has none
+func Tenant(ctx context.Context) string {
+	id, _ := ctx.Value(tenantKey{}).(string)
+	return id
+}
@@ -0,0 +1,207 @@
+package usecases
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"prom/app/db"
+	"prom/core/domain/auth"
+	"prom/core/domain/repository"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// The keys look like pk_<prefix>_<secret>, the prefix finds the stored key
+	apiKeyPrefix = "pk_"
+	// last_used_at is written at most once per resolution to keep the
+	// authentication from writing on every request
+	lastUsedResolution = time.Minute
+	// The seeded keys are at least as long as the generated ones
+	minSeedSecretLen = 32
+	maxPrefixLen     = 16
+)
+
+var (
+	ApiKeyNotFoundError = errors.New("API key Not found")
+	InvalidApiKeyError  = errors.New("Invalid API key")
+)
+
+// ApiKeyIDKey is set on the spans of the usecases of a single API key
+const ApiKeyIDKey = attribute.Key("apikey.id")
+
+// CreateApiKey stores the hash of a new random key, the returned key is only
+// known to the caller and can't be read back. The key belongs to the tenant of
+// the caller, only a caller without a tenant can pick another one. The key belongs to the tenant of
+// the caller, only a caller without a tenant can pick another one
+func CreateApiKey(conn repository.Connection, policy *auth.Policy, parentCtx context.Context, key *db.ApiKey) (*db.ApiKey, string, error) {
+	var raw string
+	key, err := traced(parentCtx, createApiKeyUC, nil, func(ctx context.Context) (*db.ApiKey, error) {
+		if err := policy.Authorize(ctx, auth.ActionAdmin, ""); err != nil {
+			return nil, err
+		}
+		if principal := auth.PrincipalFrom(ctx); principal != nil && principal.Tenant != "" {
+			if key.TenantID != "" && key.TenantID != principal.Tenant {
+				return nil, fmt.Errorf("%w: cannot create an API key of another tenant", auth.ForbiddenError)
+			}
+			key.TenantID = principal.Tenant
+		}
+
+		prefix, err := randomString(6, hex.EncodeToString)
+		if err != nil {
+			return nil, err
+		}
+		secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+		if err != nil {
+			return nil, err
+		}
+		raw = apiKeyPrefix + prefix + "_" + secret
+
+		key.Prefix = prefix
+		key.Hash = hashApiKey(raw)
+		tx := conn.WithContext(ctx).Create(key)
+		if tx.Error != nil {
+			return nil, fmt.Errorf("Cannot create API key in createApiKeyUC: %w", tx.Error)
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return key, raw, nil
+}
+
+func ListApiKeys(conn repository.Connection, policy *auth.Policy, parentCtx context.Context) ([]*db.ApiKey, error) {
+	return traced(parentCtx, listApiKeysUC, nil, func(ctx context.Context) ([]*db.ApiKey, error) {
+		if err := policy.Authorize(ctx, auth.ActionAdmin, ""); err != nil {
+			return nil, err
+		}
+
+		keys := make([]*db.ApiKey, 0)
+		tx := conn.WithContext(ctx).Find(&keys)
+
+		if tx.Error != nil {
+			return nil, fmt.Errorf("Cannot get API keys in listApiKeysUC: %w", tx.Error)
+		}
+		return keys, nil
+	})
+}
+
+// RevokeApiKey soft deletes the key, it is rejected from then on
+func RevokeApiKey(conn repository.Connection, policy *auth.Policy, parentCtx context.Context, id int) error {
+	attrs := []attribute.KeyValue{ApiKeyIDKey.Int(id)}
+	_, err := traced(parentCtx, revokeApiKeyUC, attrs, func(ctx context.Context) (struct{}, error) {
+		if err := policy.Authorize(ctx, auth.ActionAdmin, ""); err != nil {
+			return struct{}{}, err
+		}
+
+		tx := conn.WithContext(ctx).Delete(&db.ApiKey{Id: id})
+
+		if tx.Error != nil {
+			return struct{}{}, fmt.Errorf("Cannot revoke API key %d in revokeApiKeyUC: %w", id, tx.Error)
+		}
+		if tx.RowsAffected == 0 {
+			return struct{}{}, ApiKeyNotFoundError
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
+
+// AuthenticateApiKey returns the principal of a valid, unexpired and not revoked
+// key and records when it was last used
+func AuthenticateApiKey(conn repository.Connection, parentCtx context.Context, raw string) (*auth.Principal, error) {
+	return traced(parentCtx, authenticateApiKeyUC, nil, func(ctx context.Context) (*auth.Principal, error) {
+		prefix, _, ok := strings.Cut(strings.TrimPrefix(raw, apiKeyPrefix), "_")
+		if !strings.HasPrefix(raw, apiKeyPrefix) || !ok {
+			return nil, InvalidApiKeyError
+		}
+
+		key := &db.ApiKey{}
+		tx := conn.WithContext(ctx).Where("prefix = ?", prefix).Limit(1).Find(key)
+		if tx.Error != nil {
+			return nil, fmt.Errorf("Cannot get API key in authenticateApiKeyUC: %w", tx.Error)
+		}
+
+		hash := hashApiKey(raw)
+		if tx.RowsAffected == 0 || subtle.ConstantTimeCompare([]byte(hash), []byte(key.Hash)) != 1 {
+			return nil, InvalidApiKeyError
+		}
+		now := time.Now()
+		if key.ExpiresAt != nil && now.After(*key.ExpiresAt) {
+			return nil, InvalidApiKeyError
+		}
+
+		if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= lastUsedResolution {
+			// Not touching updated_at, the key itself is unchanged
+			tx = conn.WithContext(ctx).Model(key).UpdateColumn("last_used_at", now)
+			if tx.Error != nil {
+				return nil, fmt.Errorf("Cannot update API key %d in authenticateApiKeyUC: %w", key.Id, tx.Error)
+			}
+		}
+
+		return &auth.Principal{
+			Subject: "apikey:" + key.Prefix,
+			Method:  "apikey",
+			Scopes:  key.Scopes,
+			Tenant:  key.TenantID,
+		}, nil
+	})
+}
+
+// SeedApiKey stores an admin key provided by the operator when it is missing, it
+// bootstraps the management of the keys. A revoked key is not restored
+func SeedApiKey(conn repository.Connection, parentCtx context.Context, name, raw string) error {
+	_, err := traced(parentCtx, seedApiKeyUC, nil, func(ctx context.Context) (struct{}, error) {
+		prefix, secret, ok := strings.Cut(strings.TrimPrefix(raw, apiKeyPrefix), "_")
+		if !strings.HasPrefix(raw, apiKeyPrefix) || !ok || prefix == "" || len(prefix) > maxPrefixLen || len(secret) < minSeedSecretLen {
+			return struct{}{}, fmt.Errorf("%w: expected pk_<prefix>_<secret> with a prefix of at most %d characters and a secret of at least %d", InvalidApiKeyError, maxPrefixLen, minSeedSecretLen)
+		}
+
+		// Unscoped to find the revoked key too, the prefix stays taken by it
+		existing := &db.ApiKey{}
+		tx := conn.WithContext(ctx).Unscoped().Where("prefix = ?", prefix).Limit(1).Find(existing)
+		if tx.Error != nil {
+			return struct{}{}, fmt.Errorf("Cannot get API key in seedApiKeyUC: %w", tx.Error)
+		}
+		hash := hashApiKey(raw)
+		if tx.RowsAffected > 0 {
+			if subtle.ConstantTimeCompare([]byte(hash), []byte(existing.Hash)) != 1 {
+				return struct{}{}, fmt.Errorf("Cannot seed API key, the prefix %s is used by another key", prefix)
+			}
+			return struct{}{}, nil
+		}
+
+		key := &db.ApiKey{
+			Name:   name,
+			Prefix: prefix,
+			Hash:   hash,
+			Scopes: []string{string(auth.ActionAdmin)},
+		}
+		if tx := conn.WithContext(ctx).Create(key); tx.Error != nil {
+			return struct{}{}, fmt.Errorf("Cannot create API key in seedApiKeyUC: %w", tx.Error)
+		}
+		return struct{}{}, nil
+	})
+	return err
+}
+
+func hashApiKey(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("Cannot generate API key: %w", err)
+	}
+	return encode(b), nil
+}
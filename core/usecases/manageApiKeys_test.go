@@ -0,0 +1,122 @@
+package usecases
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"prom/app/db"
+	"prom/core/domain/auth"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// adminContext is the context of a caller granted the admin action
+func adminContext(t *testing.T) (*auth.Policy, context.Context) {
+	policy, err := auth.NewPolicy(true, []string{"admin=admin"}, nil, "")
+	assert.NoError(t, err)
+	return policy, auth.WithPrincipal(context.Background(), &auth.Principal{Subject: "1", Roles: []string{"admin"}})
+}
+
+func TestApiKeyLifecycle(t *testing.T) {
+	conn := newTestConn(t)
+	policy, ctx := adminContext(t)
+
+	key, raw, err := CreateApiKey(conn, policy, ctx, &db.ApiKey{Name: "batch", Scopes: []string{"user:read"}})
+	assert.NoError(t, err)
+	assert.NotContains(t, key.Hash, raw)
+	assert.Contains(t, raw, apiKeyPrefix+key.Prefix+"_")
+
+	principal, err := AuthenticateApiKey(conn, ctx, raw)
+	assert.NoError(t, err)
+	assert.Equal(t, "apikey", principal.Method)
+	assert.Equal(t, []string{"user:read"}, principal.Scopes)
+
+	stored := &db.ApiKey{}
+	assert.NoError(t, conn.First(stored, key.Id).Error)
+	assert.NotNil(t, stored.LastUsedAt)
+
+	_, err = AuthenticateApiKey(conn, ctx, raw+"x")
+	assert.ErrorIs(t, err, InvalidApiKeyError)
+	_, err = AuthenticateApiKey(conn, ctx, "not-a-key")
+	assert.ErrorIs(t, err, InvalidApiKeyError)
+
+	keys, err := ListApiKeys(conn, policy, ctx)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+
+	assert.NoError(t, RevokeApiKey(conn, policy, ctx, key.Id))
+	_, err = AuthenticateApiKey(conn, ctx, raw)
+	assert.ErrorIs(t, err, InvalidApiKeyError)
+	assert.ErrorIs(t, RevokeApiKey(conn, policy, ctx, key.Id), ApiKeyNotFoundError)
+
+	keys, err = ListApiKeys(conn, policy, ctx)
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	// The admin action is required even when the policy is not enforced
+	_, err = ListApiKeys(conn, anonymousPolicy(t), context.Background())
+	assert.ErrorIs(t, err, auth.UnauthenticatedError)
+}
+
+func TestExpiredApiKey(t *testing.T) {
+	conn := newTestConn(t)
+	policy, ctx := adminContext(t)
+
+	expired := time.Now().Add(-time.Minute)
+	_, raw, err := CreateApiKey(conn, policy, ctx, &db.ApiKey{Name: "expired", ExpiresAt: &expired})
+	assert.NoError(t, err)
+
+	_, err = AuthenticateApiKey(conn, ctx, raw)
+	assert.ErrorIs(t, err, InvalidApiKeyError)
+}
+
+func TestSeedApiKey(t *testing.T) {
+	conn := newTestConn(t)
+	policy, ctx := adminContext(t)
+	raw := "pk_bootstrap_" + strings.Repeat("s", 32)
+
+	assert.NoError(t, SeedApiKey(conn, ctx, "bootstrap", raw))
+	// Seeding again at the next startup keeps the stored key
+	assert.NoError(t, SeedApiKey(conn, ctx, "bootstrap", raw))
+	keys, err := ListApiKeys(conn, policy, ctx)
+	assert.NoError(t, err)
+	assert.Len(t, keys, 1)
+
+	principal, err := AuthenticateApiKey(conn, context.Background(), raw)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"admin"}, principal.Scopes)
+
+	assert.Error(t, SeedApiKey(conn, ctx, "bootstrap", "pk_bootstrap_"+strings.Repeat("x", 32)))
+	assert.ErrorIs(t, SeedApiKey(conn, ctx, "bootstrap", "pk_short_secret"), InvalidApiKeyError)
+	assert.ErrorIs(t, SeedApiKey(conn, ctx, "bootstrap", strings.Repeat("s", 40)), InvalidApiKeyError)
+
+	// A revoked bootstrap key is not restored by the next startup
+	assert.NoError(t, RevokeApiKey(conn, policy, ctx, keys[0].Id))
+	assert.NoError(t, SeedApiKey(conn, ctx, "bootstrap", raw))
+	_, err = AuthenticateApiKey(conn, context.Background(), raw)
+	assert.ErrorIs(t, err, InvalidApiKeyError)
+}
+
+func TestApiKeyTenant(t *testing.T) {
+	conn := newTestConn(t)
+	policy, global := adminContext(t)
+	acme := auth.WithPrincipal(context.Background(), &auth.Principal{Subject: "2", Roles: []string{"admin"}, Tenant: "acme"})
+
+	// The key of a caller with a tenant belongs to it
+	key, raw, err := CreateApiKey(conn, policy, acme, &db.ApiKey{Name: "batch"})
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", key.TenantID)
+	principal, err := AuthenticateApiKey(conn, context.Background(), raw)
+	assert.NoError(t, err)
+	assert.Equal(t, "acme", principal.Tenant)
+
+	_, _, err = CreateApiKey(conn, policy, acme, &db.ApiKey{Name: "batch", TenantID: "globex"})
+	assert.ErrorIs(t, err, auth.ForbiddenError)
+
+	// A caller without a tenant picks it
+	key, _, err = CreateApiKey(conn, policy, global, &db.ApiKey{Name: "batch", TenantID: "globex"})
+	assert.NoError(t, err)
+	assert.Equal(t, "globex", key.TenantID)
+}
@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"prom/app/db"
-	"prom/app/otel"
+	"prom/core/domain/auth"
 	"prom/core/domain/repository"
+	"strconv"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 )
 
@@ -15,98 +18,117 @@ var (
 	UserNotFoundError = errors.New("User Not found")
 )
 
-func ListUsers(conn repository.Connection, parentCtx context.Context) ([]*db.User, error) {
-	ctx, span := otel.GetTracerInstance().Start(parentCtx, "listUsersUC")
-	defer span.End()
-	userList := make([]*db.User, 0)
-	tx := conn.WithContext(ctx).Find(&userList)
+func ListUsers(conn repository.Connection, policy *auth.Policy, parentCtx context.Context) ([]*db.User, error) {
+	return traced(parentCtx, listUsersUC, nil, func(ctx context.Context) ([]*db.User, error) {
+		if err := policy.Authorize(ctx, auth.ActionUserRead, ""); err != nil {
+			return nil, err
+		}
+
+		userList := make([]*db.User, 0)
+		tx := conn.WithContext(ctx).Find(&userList)
 
-	if tx.Error != nil {
-    err := fmt.Errorf("Cannot get users in listUsersUC: %w", tx.Error)
-    span.RecordError(err)
-		return nil, err
-	}
+		if tx.Error != nil {
+			return nil, fmt.Errorf("Cannot get users in listUsersUC: %w", tx.Error)
+		}
 
-	return userList, nil
+		return userList, nil
+	})
 }
 
-func GetUser(conn repository.Connection, parentCtx context.Context, uid int) (*db.User, error) {
-	ctx, span := otel.GetTracerInstance().Start(parentCtx, "getUserUC")
-	defer span.End()
+func GetUser(conn repository.Connection, policy *auth.Policy, parentCtx context.Context, uid int) (*db.User, error) {
+	attrs := []attribute.KeyValue{UserIDKey.Int(uid)}
+	return traced(parentCtx, getUserUC, attrs, func(ctx context.Context) (*db.User, error) {
+		if err := policy.Authorize(ctx, auth.ActionUserRead, userOwner(uid)); err != nil {
+			return nil, err
+		}
 
-	user := &db.User{}
-	tx := conn.WithContext(ctx).Where("id = ?", uid).Find(user)
+		user := &db.User{}
+		tx := conn.WithContext(ctx).Where("id = ?", uid).Find(user)
 
-	if tx.RowsAffected == 0 {
-		return nil, UserNotFoundError
-	}
+		if tx.Error != nil {
+			return nil, fmt.Errorf("Cannot get user with id %d in getUserUC: %w", uid, tx.Error)
+		}
 
-	if tx.Error != nil {
-    err := fmt.Errorf("Cannot get user with id %d in getUsersUC: %w", uid, tx.Error)
-    span.RecordError(err)
-		return nil, err
-	}
-	return user, nil
+		if tx.RowsAffected == 0 {
+			return nil, UserNotFoundError
+		}
+		return user, nil
+	})
 }
 
 func CreateUser(
 	conn repository.Connection,
+	policy *auth.Policy,
 	parentCtx context.Context,
 	user *db.User,
 ) (*db.User, error) {
-	ctx, span := otel.GetTracerInstance().Start(parentCtx, "createUserUC")
-	defer span.End()
+	return traced(parentCtx, createUserUC, nil, func(ctx context.Context) (*db.User, error) {
+		if err := policy.Authorize(ctx, auth.ActionUserWrite, ""); err != nil {
+			return nil, err
+		}
 
-	tx := conn.WithContext(ctx).Create(user)
+		tx := conn.WithContext(ctx).Create(user)
 
-	if tx.Error != nil {
-    err := fmt.Errorf("Cannot create user in createUsersUC: %w", tx.Error)
-		span.RecordError(err)
-		return nil, err
-	}
-	return user, nil
+		if tx.Error != nil {
+			return nil, fmt.Errorf("Cannot create user in createUserUC: %w", tx.Error)
+		}
+		// The id is only known once created
+		trace.SpanFromContext(ctx).SetAttributes(UserIDKey.Int(user.Id))
+		return user, nil
+	})
 }
 
 func UpdateUser(
 	conn repository.Connection,
+	policy *auth.Policy,
 	parentCtx context.Context,
 	user *db.User,
 ) (*db.User, error) {
-	ctx, span := otel.GetTracerInstance().Start(parentCtx, "updateUserUC")
-	defer span.End()
+	attrs := []attribute.KeyValue{UserIDKey.Int(user.Id)}
+	return traced(parentCtx, updateUserUC, attrs, func(ctx context.Context) (*db.User, error) {
+		if err := policy.Authorize(ctx, auth.ActionUserWrite, userOwner(user.Id)); err != nil {
+			return nil, err
+		}
 
-	tx := conn.WithContext(ctx).Where("id = ?", user.Id).Updates(user)
+		tx := conn.WithContext(ctx).Where("id = ?", user.Id).Updates(user)
 
-	// Good enough if an extra read is not acceptable
-	if tx.RowsAffected == 0 {
-		return nil, UserNotFoundError
-	}
+		if tx.Error != nil {
+			switch {
+			case errors.Is(tx.Error, gorm.ErrRecordNotFound):
+				return nil, UserNotFoundError
+			default:
+				return nil, fmt.Errorf("Cannot update user in updateUserUC: %w", tx.Error)
+			}
+		}
 
-	if tx.Error != nil {
-		switch {
-		case errors.Is(tx.Error, gorm.ErrRecordNotFound):
+		// Good enough if an extra read is not acceptable
+		if tx.RowsAffected == 0 {
 			return nil, UserNotFoundError
-		default:
-      err := fmt.Errorf("Cannot create user in updateUsersUC: %w", tx.Error)
-		  span.RecordError(err)
-			return nil, err
 		}
-	}
-	return user, nil
+		return user, nil
+	})
 }
 
-func DeleteUser(conn repository.Connection, parentCtx context.Context, uid int) error {
-	ctx, span := otel.GetTracerInstance().Start(parentCtx, "createUserUC")
-	defer span.End()
+func DeleteUser(conn repository.Connection, policy *auth.Policy, parentCtx context.Context, uid int) error {
+	attrs := []attribute.KeyValue{UserIDKey.Int(uid)}
+	_, err := traced(parentCtx, deleteUserUC, attrs, func(ctx context.Context) (struct{}, error) {
+		if err := policy.Authorize(ctx, auth.ActionUserDelete, userOwner(uid)); err != nil {
+			return struct{}{}, err
+		}
+
+		tx := conn.WithContext(ctx).Delete(&db.User{
+			Id: uid,
+		})
 
-	tx := conn.WithContext(ctx).Delete(&db.User{
-		Id: uid,
+		if tx.Error != nil {
+			return struct{}{}, fmt.Errorf("Cannot delete user %d in deleteUserUC: %w", uid, tx.Error)
+		}
+		return struct{}{}, nil
 	})
+	return err
+}
 
-	if tx.Error != nil {
-    err := fmt.Errorf("Cannot delete user %d in deleteUsersUC: %w", uid, tx.Error)
-		span.RecordError(err)
-		return err
-	}
-	return nil
+// userOwner is the subject owning the user, the users authenticate with their id
+func userOwner(uid int) string {
+	return strconv.Itoa(uid)
 }
@@ -0,0 +1,93 @@
+package usecases
+
+import (
+	"context"
+	"errors"
+	"prom/app/db"
+	"prom/app/otel"
+	"prom/core/domain/auth"
+	"sync"
+	"time"
+
+	otelapi "go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/syncfloat64"
+	"go.opentelemetry.io/otel/metric/instrument/syncint64"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+const (
+	usecaseNameKey    = attribute.Key("usecase.name")
+	usecaseOutcomeKey = attribute.Key("usecase.outcome")
+)
+
+type usecaseMetrics struct {
+	duration syncfloat64.Histogram
+	calls    syncint64.Counter
+}
+
+var (
+	usecaseMetricsOnce sync.Once
+	usecaseMetricsInst *usecaseMetrics
+)
+
+func newUsecaseMetrics(meter metric.Meter) (*usecaseMetrics, error) {
+	duration, err := meter.SyncFloat64().Histogram(
+		"usecase.duration",
+		instrument.WithDescription("Duration of the usecases"),
+		instrument.WithUnit(unit.Milliseconds),
+	)
+	if err != nil {
+		return nil, err
+	}
+	calls, err := meter.SyncInt64().Counter(
+		"usecase.calls",
+		instrument.WithDescription("Number of usecase calls by outcome"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &usecaseMetrics{duration: duration, calls: calls}, nil
+}
+
+func getUsecaseMetrics() *usecaseMetrics {
+	usecaseMetricsOnce.Do(func() {
+		m, err := newUsecaseMetrics(otel.GetMeterInstance())
+		if err != nil {
+			otelapi.Handle(err)
+			// Never fails for the noop meter
+			m, _ = newUsecaseMetrics(metric.NewNoopMeter())
+		}
+		usecaseMetricsInst = m
+	})
+	return usecaseMetricsInst
+}
+
+func usecaseOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case errors.Is(err, UserNotFoundError), errors.Is(err, ApiKeyNotFoundError):
+		return "not_found"
+	case errors.Is(err, InvalidApiKeyError):
+		return "rejected"
+	case errors.Is(err, auth.UnauthenticatedError), errors.Is(err, auth.ForbiddenError), errors.Is(err, db.ErrMissingTenant):
+		return "denied"
+	default:
+		return "error"
+	}
+}
+
+// recordUsecase is deferred by the usecases with a pointer to their named
+// error so the outcome is read once the usecase has returned
+func recordUsecase(ctx context.Context, name string, start time.Time, err *error) {
+	m := getUsecaseMetrics()
+	attrs := []attribute.KeyValue{
+		usecaseNameKey.String(name),
+		usecaseOutcomeKey.String(usecaseOutcome(*err)),
+	}
+	m.calls.Add(ctx, 1, attrs...)
+	m.duration.Record(ctx, float64(time.Since(start).Microseconds())/1000, attrs...)
+}
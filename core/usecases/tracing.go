@@ -0,0 +1,68 @@
+package usecases
+
+import (
+	"context"
+	"prom/app/otel"
+	"prom/core/domain/tenancy"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// UserIDKey is set on the spans of the usecases and handlers of a single user
+const UserIDKey = attribute.Key("user.id")
+
+// TenantIDKey is set on the spans of the usecases run for a tenant
+const TenantIDKey = attribute.Key("tenant.id")
+
+// usecase names the span and the metrics of a usecase, operation is the db
+// operation it performs
+type usecase struct {
+	name      string
+	operation string
+}
+
+var (
+	listUsersUC  = usecase{"listUsersUC", "select"}
+	getUserUC    = usecase{"getUserUC", "select"}
+	createUserUC = usecase{"createUserUC", "insert"}
+	updateUserUC = usecase{"updateUserUC", "update"}
+	deleteUserUC = usecase{"deleteUserUC", "delete"}
+
+	createApiKeyUC       = usecase{"createApiKeyUC", "insert"}
+	listApiKeysUC        = usecase{"listApiKeysUC", "select"}
+	revokeApiKeyUC       = usecase{"revokeApiKeyUC", "update"}
+	authenticateApiKeyUC = usecase{"authenticateApiKeyUC", "select"}
+	seedApiKeyUC         = usecase{"seedApiKeyUC", "insert"}
+)
+
+// traced runs fn in the span of the usecase and records its metrics, the span
+// status is set from the returned error, only the failures are errors
+func traced[T any](
+	parentCtx context.Context,
+	uc usecase,
+	attrs []attribute.KeyValue,
+	fn func(ctx context.Context) (T, error),
+) (_ T, err error) {
+	attrs = append(attrs, semconv.DBOperationKey.String(uc.operation))
+	if tenant := tenancy.Tenant(parentCtx); tenant != "" {
+		attrs = append(attrs, TenantIDKey.String(tenant))
+	}
+	ctx, span := otel.GetTracerInstance().Start(parentCtx, uc.name, trace.WithAttributes(attrs...))
+	defer span.End()
+	defer recordUsecase(ctx, uc.name, time.Now(), &err)
+
+	result, err := fn(ctx)
+
+	outcome := usecaseOutcome(err)
+	span.SetAttributes(usecaseOutcomeKey.String(outcome))
+	// The not found, rejected and denied outcomes are answers, not failures
+	if outcome == "error" {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return result, err
+}
@@ -0,0 +1,117 @@
+package usecases
+
+import (
+	"context"
+	"prom/app/db"
+	"prom/core/domain/auth"
+	"strconv"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var recorder = tracetest.NewSpanRecorder()
+
+func init() {
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+}
+
+func lastSpan(t *testing.T, name string) sdktrace.ReadOnlySpan {
+	spans := recorder.Ended()
+	for i := len(spans) - 1; i >= 0; i-- {
+		if spans[i].Name() == name {
+			return spans[i]
+		}
+	}
+	t.Fatalf("Span %s was not ended", name)
+	return nil
+}
+
+func spanAttributes(span sdktrace.ReadOnlySpan) map[attribute.Key]string {
+	attrs := map[attribute.Key]string{}
+	for _, kv := range span.Attributes() {
+		attrs[kv.Key] = kv.Value.Emit()
+	}
+	return attrs
+}
+
+// anonymousPolicy is the policy without authentication, only admin is denied
+func anonymousPolicy(t *testing.T) *auth.Policy {
+	p, err := auth.NewPolicy(false, nil, nil, "")
+	assert.NoError(t, err)
+	return p
+}
+
+func newTestConn(t *testing.T) *gorm.DB {
+	conn, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	assert.NoError(t, err)
+	assert.NoError(t, conn.AutoMigrate(&db.User{}, &db.ApiKey{}))
+	return conn
+}
+
+func TestDeleteUserSpan(t *testing.T) {
+	conn := newTestConn(t)
+
+	assert.NoError(t, DeleteUser(conn, anonymousPolicy(t), context.Background(), 7))
+
+	span := lastSpan(t, "deleteUserUC")
+	attrs := spanAttributes(span)
+	assert.Equal(t, "7", attrs[UserIDKey])
+	assert.Equal(t, "delete", attrs["db.operation"])
+	assert.Equal(t, "success", attrs[usecaseOutcomeKey])
+	assert.Equal(t, codes.Unset, span.Status().Code)
+}
+
+func TestGetUserSpanStatus(t *testing.T) {
+	conn := newTestConn(t)
+
+	_, err := GetUser(conn, anonymousPolicy(t), context.Background(), 1)
+	assert.ErrorIs(t, err, UserNotFoundError)
+	span := lastSpan(t, "getUserUC")
+	assert.Equal(t, "not_found", spanAttributes(span)[usecaseOutcomeKey])
+	assert.Equal(t, codes.Unset, span.Status().Code)
+
+	sqlDB, err := conn.DB()
+	assert.NoError(t, err)
+	sqlDB.Close()
+
+	_, err = GetUser(conn, anonymousPolicy(t), context.Background(), 1)
+	assert.Error(t, err)
+	span = lastSpan(t, "getUserUC")
+	assert.Equal(t, "error", spanAttributes(span)[usecaseOutcomeKey])
+	assert.Equal(t, codes.Error, span.Status().Code)
+	assert.Len(t, span.Events(), 1)
+}
+
+func TestCreateUserSpan(t *testing.T) {
+	conn := newTestConn(t)
+
+	user, err := CreateUser(conn, anonymousPolicy(t), context.Background(), &db.User{Name: "Integration Test"})
+	assert.NoError(t, err)
+
+	attrs := spanAttributes(lastSpan(t, "createUserUC"))
+	assert.Equal(t, "insert", attrs["db.operation"])
+	assert.Equal(t, strconv.Itoa(user.Id), attrs[UserIDKey])
+}
+
+func TestDeleteUserDenied(t *testing.T) {
+	conn := newTestConn(t)
+	policy, err := auth.NewPolicy(true, []string{"viewer=user:read"}, []string{"user:read", "user:write"}, "")
+	assert.NoError(t, err)
+	ctx := auth.WithPrincipal(context.Background(), &auth.Principal{Subject: "7", Method: "jwt", Roles: []string{"viewer"}})
+
+	err = DeleteUser(conn, policy, ctx, 7)
+	assert.ErrorIs(t, err, auth.ForbiddenError)
+
+	span := lastSpan(t, "deleteUserUC")
+	assert.Equal(t, "denied", spanAttributes(span)[usecaseOutcomeKey])
+	assert.Equal(t, codes.Unset, span.Status().Code)
+}
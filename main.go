@@ -2,11 +2,8 @@ package main
 
 import (
 	"log"
-	"prom/app/config"
 )
 
-var conf = config.GetConfig()
-
 func main() {
   a, err := initializeApplication()
 
@@ -14,6 +11,8 @@ func main() {
     log.Fatal(err)
   }
 
-	a.Start()
+	if err := a.Start(); err != nil {
+		log.Fatal(err)
+	}
 	a.Shutdown()
 }
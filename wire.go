@@ -7,23 +7,39 @@ import (
 	"prom/app"
   "github.com/google/wire"
 	logadapter "prom/app/otel/zapadapter"
+	"prom/core/domain/auth"
 	"prom/core/domain/logger"
   "prom/core/domain/repository"
 	"prom/app/db"
+	"prom/app/fbr"
 	"github.com/gofiber/fiber/v2"
 	"prom/app/otel"
+	"prom/app/config"
 )
 
-func ProvideZapLogger() (logger.Logger, error) {
-	return logadapter.NewZapLogger()
+func ProvideConfig() (*config.AppConfig, error) {
+	return config.New()
 }
 
-func ProvideMysqlUserRepo() (repository.Connection, error)  {
-  return db.New(conf.DBConnectionString)
+func ProvideZapLogger(conf *config.AppConfig) (logger.Logger, error) {
+	return logadapter.NewZapLogger(conf)
 }
 
-func ProvideFiberHttpAdapter() *fiber.App  {
-  return fiber.New()
+func ProvideMysqlUserRepo(conf *config.AppConfig, log logger.Logger) (repository.Connection, error)  {
+  dbLogger, err := db.NewLogger(log, conf)
+  if err != nil {
+    return nil, err
+  }
+  return db.New(conf.DBConnectionString, dbLogger, conf.TenancyEnabled)
+}
+
+// ProvidePolicy is only enforced with authentication, except the admin action
+func ProvidePolicy(conf *config.AppConfig) (*auth.Policy, error) {
+	return auth.NewPolicy(conf.AuthEnabled, conf.AuthzRoles, conf.AuthzOwnerActions, conf.AuthIssuer)
+}
+
+func ProvideFiberHttpAdapter(conf *config.AppConfig) *fiber.App  {
+  return fiber.New(fbr.HttpAdapterConfig(conf))
 }
 
 
@@ -36,11 +52,13 @@ func ProvideOtelAWSProvider() *app.OtelProviderImpl {
 
 
 var Set = wire.NewSet(
+    ProvideConfig,
     ProvideZapLogger,
     ProvideMysqlUserRepo,
+    ProvidePolicy,
     ProvideFiberHttpAdapter,
     ProvideOtelAWSProvider,
-    wire.Struct(new(app.Application), "Logger", "UserRepo", "HttpAdapter", "OtelProvider"))
+    wire.Struct(new(app.Application), "Config", "Logger", "UserRepo", "Policy", "HttpAdapter", "OtelProvider"))
 
 
 func initializeApplication() (*app.Application, error) {
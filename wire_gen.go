@@ -10,9 +10,12 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/wire"
 	"prom/app"
+	"prom/app/config"
 	"prom/app/db"
+	"prom/app/fbr"
 	"prom/app/otel"
 	"prom/app/otel/zapadapter"
+	"prom/core/domain/auth"
 	"prom/core/domain/logger"
 	"prom/core/domain/repository"
 )
@@ -20,19 +23,29 @@ import (
 // Injectors from wire.go:
 
 func initializeApplication() (*app.Application, error) {
-	logger, err := ProvideZapLogger()
+	appConfig, err := ProvideConfig()
 	if err != nil {
 		return nil, err
 	}
-	db, err := ProvideMysqlUserRepo()
+	logger, err := ProvideZapLogger(appConfig)
 	if err != nil {
 		return nil, err
 	}
-	fiberApp := ProvideFiberHttpAdapter()
+	v, err := ProvideMysqlUserRepo(appConfig, logger)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := ProvidePolicy(appConfig)
+	if err != nil {
+		return nil, err
+	}
+	fiberApp := ProvideFiberHttpAdapter(appConfig)
 	otelProviderImpl := ProvideOtelAWSProvider()
 	application := &app.Application{
+		Config:       appConfig,
 		Logger:       logger,
-		UserRepo:     db,
+		UserRepo:     v,
+		Policy:       policy,
 		HttpAdapter:  fiberApp,
 		OtelProvider: otelProviderImpl,
 	}
@@ -41,16 +54,29 @@ func initializeApplication() (*app.Application, error) {
 
 // wire.go:
 
-func ProvideZapLogger() (logger.Logger, error) {
-	return zap.NewZapLogger()
+func ProvideConfig() (*config.AppConfig, error) {
+	return config.New()
+}
+
+func ProvideZapLogger(conf *config.AppConfig) (logger.Logger, error) {
+	return zap.NewZapLogger(conf)
+}
+
+func ProvideMysqlUserRepo(conf *config.AppConfig, log logger.Logger) (repository.Connection, error) {
+	dbLogger, err := db.NewLogger(log, conf)
+	if err != nil {
+		return nil, err
+	}
+	return db.New(conf.DBConnectionString, dbLogger, conf.TenancyEnabled)
 }
 
-func ProvideMysqlUserRepo() (repository.Connection, error) {
-	return db.New(conf.DBConnectionString)
+// ProvidePolicy is only enforced with authentication, except the admin action
+func ProvidePolicy(conf *config.AppConfig) (*auth.Policy, error) {
+	return auth.NewPolicy(conf.AuthEnabled, conf.AuthzRoles, conf.AuthzOwnerActions, conf.AuthIssuer)
 }
 
-func ProvideFiberHttpAdapter() *fiber.App {
-	return fiber.New()
+func ProvideFiberHttpAdapter(conf *config.AppConfig) *fiber.App {
+	return fiber.New(fbr.HttpAdapterConfig(conf))
 }
 
 func ProvideOtelAWSProvider() *app.OtelProviderImpl {
@@ -61,7 +87,9 @@ func ProvideOtelAWSProvider() *app.OtelProviderImpl {
 }
 
 var Set = wire.NewSet(
+	ProvideConfig,
 	ProvideZapLogger,
 	ProvideMysqlUserRepo,
+	ProvidePolicy,
 	ProvideFiberHttpAdapter,
-	ProvideOtelAWSProvider, wire.Struct(new(app.Application), "Logger", "UserRepo", "HttpAdapter", "OtelProvider"))
+	ProvideOtelAWSProvider, wire.Struct(new(app.Application), "Config", "Logger", "UserRepo", "Policy", "HttpAdapter", "OtelProvider"))